@@ -26,6 +26,24 @@ func tableSemGrepFinding(ctx context.Context) *plugin.Table {
 				Transform:   transform.FromField("Description.ID"),
 				Description: "The unique identifier of the finding.",
 			},
+			{
+				Name:        "deployment_id",
+				Type:        proto.ColumnType_INT,
+				Transform:   transform.FromField("Description.DeploymentID"),
+				Description: "The ID of the deployment the finding belongs to.",
+			},
+			{
+				Name:        "project_id",
+				Type:        proto.ColumnType_INT,
+				Transform:   transform.FromField("Description.ProjectID"),
+				Description: "The ID of the project the finding was detected in.",
+			},
+			{
+				Name:        "project_tags",
+				Type:        proto.ColumnType_JSON,
+				Transform:   transform.FromField("Description.ProjectTags"),
+				Description: "Tags of the project the finding was detected in.",
+			},
 			{
 				Name:        "ref",
 				Type:        proto.ColumnType_STRING,
@@ -34,7 +52,7 @@ func tableSemGrepFinding(ctx context.Context) *plugin.Table {
 			},
 			{
 				Name:        "first_seen_scan_id",
-				Type:        proto.ColumnType_INT,
+				Type:        proto.ColumnType_STRING,
 				Transform:   transform.FromField("Description.FirstSeenScanID"),
 				Description: "The ID of the scan where this finding was first seen.",
 			},
@@ -26,6 +26,12 @@ func tableSemGrepProject(ctx context.Context) *plugin.Table {
 				Transform:   transform.FromField("Description.ID"),
 				Description: "The unique identifier of the project.",
 			},
+			{
+				Name:        "deployment_id",
+				Type:        proto.ColumnType_INT,
+				Transform:   transform.FromField("Description.DeploymentID"),
+				Description: "The ID of the deployment the project belongs to.",
+			},
 			{
 				Name:        "name",
 				Type:        proto.ColumnType_STRING,
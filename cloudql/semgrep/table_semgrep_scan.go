@@ -28,10 +28,22 @@ func tableSemGrepScan(ctx context.Context) *plugin.Table {
 			},
 			{
 				Name:        "deployment_id",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_INT,
 				Transform:   transform.FromField("Description.DeploymentID"),
 				Description: "The deployment ID associated with the scan.",
 			},
+			{
+				Name:        "project_id",
+				Type:        proto.ColumnType_INT,
+				Transform:   transform.FromField("Description.ProjectID"),
+				Description: "The ID of the project the scan was run against.",
+			},
+			{
+				Name:        "project_tags",
+				Type:        proto.ColumnType_JSON,
+				Transform:   transform.FromField("Description.ProjectTags"),
+				Description: "Tags of the project the scan was run against.",
+			},
 			{
 				Name:        "repository_id",
 				Type:        proto.ColumnType_STRING,
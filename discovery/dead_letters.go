@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/opengovern/og-describer-semgrep/discovery/pkg"
+	"github.com/opengovern/og-util/pkg/describe"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func DeadLetterCommand() *cobra.Command {
+	var natsURL string
+	cmd := &cobra.Command{
+		Use:   "dead-letters",
+		Short: "Inspect and requeue the describe jobs parked on the dead-letter subject",
+	}
+	cmd.PersistentFlags().StringVar(&natsURL, "nats-url", os.Getenv("NATS_URL"), "NATS server URL")
+
+	var limit int
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the dead-lettered jobs, oldest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q, err := pkg.NewDeadLetterQueue(natsURL)
+			if err != nil {
+				return err
+			}
+			defer q.Close()
+
+			deadLetters, err := q.List(cmd.Context(), limit)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SEQUENCE\tJOB\tRESOURCE TYPE\tREASON\tDELIVERIES\tRETRIES\tWORKER\tFAILED AT\tERROR")
+			for _, deadLetter := range deadLetters {
+				var input describe.DescribeWorkerInput
+				_ = json.Unmarshal(deadLetter.Data, &input)
+				fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n", deadLetter.Sequence, input.DescribeJob.JobID,
+					input.DescribeJob.ResourceType, deadLetter.Reason, deadLetter.Deliveries, deadLetter.RetryCounter,
+					deadLetter.WorkerID, deadLetter.FailedAt.Format(time.RFC3339), deadLetter.Error)
+			}
+			return w.Flush()
+		},
+	}
+	listCmd.Flags().IntVar(&limit, "limit", 100, "Maximum number of jobs listed, 0 lists them all")
+
+	showCmd := &cobra.Command{
+		Use:   "show <sequence>",
+		Short: "Print the payload of a dead-lettered job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			seq, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid sequence: %w", err)
+			}
+			q, err := pkg.NewDeadLetterQueue(natsURL)
+			if err != nil {
+				return err
+			}
+			defer q.Close()
+
+			deadLetter, err := q.Get(cmd.Context(), seq)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Println(string(deadLetter.Data))
+			return err
+		},
+	}
+
+	requeueCmd := &cobra.Command{
+		Use:   "requeue <sequence>...",
+		Short: "Publish dead-lettered jobs back on their original subject",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q, err := pkg.NewDeadLetterQueue(natsURL)
+			if err != nil {
+				return err
+			}
+			defer q.Close()
+
+			for _, arg := range args {
+				seq, err := strconv.ParseUint(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid sequence %s: %w", arg, err)
+				}
+				if err = q.Requeue(cmd.Context(), seq); err != nil {
+					return fmt.Errorf("failed to requeue %d: %w", seq, err)
+				}
+				fmt.Printf("requeued %d\n", seq)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(listCmd, showCmd, requeueCmd)
+	return cmd
+}
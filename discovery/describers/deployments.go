@@ -12,6 +12,10 @@ import (
 )
 
 func ListDeployments(ctx context.Context, handler *provider.SemGrepAPIHandler, stream *models.StreamSender) ([]models.Resource, error) {
+	// stop paging the Semgrep API as soon as the consumer gives up, e.g. when the stream fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var wg sync.WaitGroup
 	semGrepChan := make(chan models.Resource)
 	errorChan := make(chan error, 1) // Buffered channel to capture errors
@@ -20,7 +24,10 @@ func ListDeployments(ctx context.Context, handler *provider.SemGrepAPIHandler, s
 		defer close(semGrepChan)
 		defer close(errorChan)
 		if err := processDeployments(ctx, handler, semGrepChan, &wg); err != nil {
-			errorChan <- err // Send error to the error channel
+			select {
+			case errorChan <- err: // Send error to the error channel
+			case <-ctx.Done():
+			}
 		}
 		wg.Wait()
 	}()
@@ -30,6 +37,10 @@ func ListDeployments(ctx context.Context, handler *provider.SemGrepAPIHandler, s
 		select {
 		case value, ok := <-semGrepChan:
 			if !ok {
+				// errorChan is closed first, an error sent right before the end must not be missed
+				if err := <-errorChan; err != nil {
+					return nil, err
+				}
 				return values, nil
 			}
 			if stream != nil {
@@ -47,7 +58,6 @@ func ListDeployments(ctx context.Context, handler *provider.SemGrepAPIHandler, s
 
 func processDeployments(ctx context.Context, handler *provider.SemGrepAPIHandler, semGrepChan chan<- models.Resource, wg *sync.WaitGroup) error {
 	var deploymentListResponse provider.DeploymentsResponse
-	var resp *http.Response
 	baseURL := "https://semgrep.dev/api/v1/deployments"
 
 	req, err := http.NewRequest("GET", baseURL, nil)
@@ -55,21 +65,14 @@ func processDeployments(ctx context.Context, handler *provider.SemGrepAPIHandler
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	requestFunc := func(req *http.Request) (*http.Response, error) {
-		var e error
-		resp, e = handler.Client.Do(req)
-		if e != nil {
-			return nil, fmt.Errorf("request execution failed: %w", e)
+	decode := func(resp *http.Response) error {
+		if e := json.NewDecoder(resp.Body).Decode(&deploymentListResponse); e != nil {
+			return fmt.Errorf("failed to decode response: %w", e)
 		}
-		defer resp.Body.Close()
-
-		if e = json.NewDecoder(resp.Body).Decode(&deploymentListResponse); e != nil {
-			return nil, fmt.Errorf("failed to decode response: %w", e)
-		}
-		return resp, nil
+		return nil
 	}
 
-	err = handler.DoRequest(ctx, req, requestFunc)
+	err = handler.DoRequest(ctx, req, decode)
 	if err != nil {
 		return fmt.Errorf("error during request handling: %w", err)
 	}
@@ -84,6 +87,10 @@ func processDeployments(ctx context.Context, handler *provider.SemGrepAPIHandler
 			value := models.Resource{
 				ID:   strconv.Itoa(deployment.ID),
 				Name: deployment.Name,
+				IntegrationMetadata: provider.Metadata{
+					DeploymentID:   deployment.ID,
+					DeploymentSlug: deployment.Slug,
+				},
 				Description: provider.DeploymentDescription{
 					Slug:     deployment.Slug,
 					ID:       deployment.ID,
@@ -91,7 +98,10 @@ func processDeployments(ctx context.Context, handler *provider.SemGrepAPIHandler
 					Findings: findings,
 				},
 			}
-			semGrepChan <- value
+			select {
+			case semGrepChan <- value:
+			case <-ctx.Done():
+			}
 		}(deployment)
 	}
 	return nil
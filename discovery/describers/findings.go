@@ -9,27 +9,74 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
-	"sync"
+
+	"go.uber.org/zap"
 )
 
 func ListFindings(ctx context.Context, handler *provider.SemGrepAPIHandler, stream *models.StreamSender) ([]models.Resource, error) {
-	var wg sync.WaitGroup
+	// stop paging the Semgrep API as soon as the consumer gives up, e.g. when the stream fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	semGrepChan := make(chan models.Resource)
+	pageChan := make(chan findingsPage)
 	errorChan := make(chan error, 1) // Buffered channel to capture errors
 	deployments, err := provider.ListDeployments(ctx, handler)
 	if err != nil {
 		return nil, err
 	}
 
+	checkpoints := provider.GetCheckpointsFromContext(ctx)
+	checkpoint := checkpoints.Load(ctx)
+	if checkpoint != nil && !hasDeployment(deployments, checkpoint.Deployment) {
+		// the deployment is gone, nothing to resume
+		checkpoint = nil
+	}
+	if checkpoint != nil {
+		provider.GetLoggerFromContext(ctx).Info("resuming findings from checkpoint",
+			zap.String("deployment", checkpoint.Deployment), zap.Int("page", checkpoint.Page))
+		checkpoints.SetResumed()
+	}
+
 	go func() {
 		defer close(semGrepChan)
 		defer close(errorChan)
 		for _, deployment := range deployments {
-			if err := processFindings(ctx, handler, deployment.Slug, semGrepChan, &wg); err != nil {
-				errorChan <- err // Send error to the error channel
+			startPage := 0
+			if checkpoint != nil {
+				// the deployments before the checkpoint were described by the previous attempt
+				if deployment.Slug != checkpoint.Deployment {
+					continue
+				}
+				startPage = checkpoint.Page
+				checkpoint = nil
+			}
+
+			provider.GetProgressFromContext(ctx).SetLocation(deployment.Slug, "")
+			scope := provider.DeploymentScope(deployment.Slug)
+			provider.GetCoverageFromContext(ctx).Start(scope)
+			projects, err := provider.ListProjects(ctx, handler, deployment.Slug)
+			if err != nil {
+				select {
+				case errorChan <- err: // Send error to the error channel
+				case <-ctx.Done():
+				}
+				continue
+			}
+			// Findings only reference their repository by name, so resolve projects from it
+			projectsByName := make(map[string]provider.ProjectJSON, len(projects))
+			for _, project := range projects {
+				projectsByName[project.Name] = project
+			}
+			if err := processFindings(ctx, handler, deployment, projectsByName, startPage, semGrepChan, pageChan); err != nil {
+				select {
+				case errorChan <- err: // Send error to the error channel
+				case <-ctx.Done():
+				}
+				continue
 			}
+			provider.GetCoverageFromContext(ctx).Done(scope)
 		}
-		wg.Wait()
 	}()
 
 	var values []models.Resource
@@ -37,6 +84,10 @@ func ListFindings(ctx context.Context, handler *provider.SemGrepAPIHandler, stre
 		select {
 		case value, ok := <-semGrepChan:
 			if !ok {
+				// errorChan is closed first, an error sent right before the end must not be missed
+				if err := <-errorChan; err != nil {
+					return nil, err
+				}
 				return values, nil
 			}
 			if stream != nil {
@@ -46,130 +97,160 @@ func ListFindings(ctx context.Context, handler *provider.SemGrepAPIHandler, stre
 			} else {
 				values = append(values, value)
 			}
+		case page := <-pageChan:
+			// every finding of the page went through the stream before the page was reported, Save waits for
+			// the sink to deliver them
+			checkpoints.Save(ctx, page.deployment, page.next)
 		case err := <-errorChan:
 			return nil, err
 		}
 	}
 }
 
-func processFindings(ctx context.Context, handler *provider.SemGrepAPIHandler, deploymentSlug string, semGrepChan chan<- models.Resource, wg *sync.WaitGroup) error {
-	var findings []provider.FindingObject
+// findingsPage reported once all the findings of a page were sent, next is the page to resume from
+type findingsPage struct {
+	deployment string
+	next       int
+}
+
+func hasDeployment(deployments []provider.DeploymentJSON, slug string) bool {
+	for _, deployment := range deployments {
+		if deployment.Slug == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// processFindings sends the findings of the deployment page by page from startPage, reporting every page sent
+func processFindings(ctx context.Context, handler *provider.SemGrepAPIHandler, deployment provider.DeploymentJSON, projectsByName map[string]provider.ProjectJSON, startPage int, semGrepChan chan<- models.Resource, pageChan chan<- findingsPage) error {
 	var findingListResponse provider.FindingsListResponse
-	var resp *http.Response
 	baseURL := "https://semgrep.dev/api/v1/deployments/"
-	page := 0
+	page := startPage
 
 	for {
 		params := url.Values{}
 		params.Set("page", strconv.Itoa(page))
 		params.Set("page_size", "3000")
-		finalURL := fmt.Sprintf("%s%s/findings?%s", baseURL, deploymentSlug, params.Encode())
+		finalURL := fmt.Sprintf("%s%s/findings?%s", baseURL, deployment.Slug, params.Encode())
 
 		req, err := http.NewRequest("GET", finalURL, nil)
 		if err != nil {
 			return fmt.Errorf("failed to create request: %w", err)
 		}
 
-		requestFunc := func(req *http.Request) (*http.Response, error) {
-			var e error
-			resp, e = handler.Client.Do(req)
-			if e != nil {
-				return nil, fmt.Errorf("request execution failed: %w", e)
-			}
-			defer resp.Body.Close()
-
-			if e = json.NewDecoder(resp.Body).Decode(&findingListResponse); e != nil {
-				return nil, fmt.Errorf("failed to decode response: %w", e)
+		decode := func(resp *http.Response) error {
+			findingListResponse = provider.FindingsListResponse{}
+			if e := json.NewDecoder(resp.Body).Decode(&findingListResponse); e != nil {
+				return fmt.Errorf("failed to decode response: %w", e)
 			}
-			findings = append(findings, findingListResponse.Findings...)
-			return resp, nil
+			return nil
 		}
 
-		err = handler.DoRequest(ctx, req, requestFunc)
+		err = handler.DoRequest(ctx, req, decode)
 		if err != nil {
 			return fmt.Errorf("error during request handling: %w", err)
 		}
 
+		for _, finding := range findingListResponse.Findings {
+			select {
+			case semGrepChan <- findingResource(deployment, projectsByName, finding):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case pageChan <- findingsPage{deployment: deployment.Slug, next: page + 1}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
 		if len(findingListResponse.Findings) < 3000 {
 			break
 		}
 		page++
 	}
+	return nil
+}
 
-	for _, finding := range findings {
-		wg.Add(1)
-		go func(finding provider.FindingObject) {
-			defer wg.Done()
-			externalTicket := provider.ExternalTicket{
-				ExternalSlug: finding.ExternalTicket.ExternalSlug,
-				URL:          finding.ExternalTicket.URL,
-			}
-			repository := provider.Repository{
-				Name: finding.Repository.Name,
-				URL:  finding.Repository.URL,
-			}
-			location := provider.Location{
-				FilePath:  finding.Location.FilePath,
-				Line:      finding.Location.Line,
-				Column:    finding.Location.Column,
-				EndLine:   finding.Location.EndLine,
-				EndColumn: finding.Location.EndColumn,
-			}
-			sourcingPolicy := provider.SourcingPolicy{
-				ID:   finding.SourcingPolicy.ID,
-				Name: finding.SourcingPolicy.Name,
-				Slug: finding.SourcingPolicy.Slug,
-			}
-			rule := provider.Rule{
-				Name:                 finding.Rule.Name,
-				Message:              finding.Rule.Message,
-				Confidence:           finding.Rule.Confidence,
-				Category:             finding.Rule.Category,
-				Subcategories:        finding.Rule.Subcategories,
-				VulnerabilityClasses: finding.Rule.VulnerabilityClasses,
-				CWENames:             finding.Rule.CWENames,
-				OWASPNames:           finding.Rule.OWASPNames,
-			}
-			assistant := provider.Assistant{
-				Autofix:    finding.Assistant.Autofix,
-				Guidance:   finding.Assistant.Guidance,
-				Autotriage: finding.Assistant.Autotriage,
-				Component:  finding.Assistant.Component,
-			}
-			value := models.Resource{
-				ID:   strconv.Itoa(finding.ID),
-				Name: strconv.Itoa(finding.ID),
-				Description: provider.FindingDescription{
-					ID:              finding.ID,
-					Ref:             finding.Ref,
-					FirstSeenScanID: finding.FirstSeenScanID,
-					SyntacticID:     finding.SyntacticID,
-					MatchBasedID:    finding.MatchBasedID,
-					ExternalTicket:  externalTicket,
-					Repository:      repository,
-					LineOfCodeURL:   finding.LineOfCodeURL,
-					TriageState:     finding.TriageState,
-					State:           finding.State,
-					Status:          finding.Status,
-					Severity:        finding.Severity,
-					Confidence:      finding.Confidence,
-					Categories:      finding.Categories,
-					CreatedAt:       finding.CreatedAt,
-					RelevantSince:   finding.RelevantSince,
-					RuleName:        finding.RuleName,
-					RuleMessage:     finding.RuleMessage,
-					Location:        location,
-					SourcingPolicy:  sourcingPolicy,
-					TriagedAt:       finding.TriagedAt,
-					TriageComment:   finding.TriageComment,
-					TriageReason:    finding.TriageReason,
-					StateUpdatedAt:  finding.StateUpdatedAt,
-					Rule:            rule,
-					Assistant:       assistant,
-				},
-			}
-			semGrepChan <- value
-		}(finding)
+func findingResource(deployment provider.DeploymentJSON, projectsByName map[string]provider.ProjectJSON, finding provider.FindingObject) models.Resource {
+	externalTicket := provider.ExternalTicket{
+		ExternalSlug: finding.ExternalTicket.ExternalSlug,
+		URL:          finding.ExternalTicket.URL,
+	}
+	repository := provider.Repository{
+		Name: finding.Repository.Name,
+		URL:  finding.Repository.URL,
+	}
+	location := provider.Location{
+		FilePath:  finding.Location.FilePath,
+		Line:      finding.Location.Line,
+		Column:    finding.Location.Column,
+		EndLine:   finding.Location.EndLine,
+		EndColumn: finding.Location.EndColumn,
+	}
+	sourcingPolicy := provider.SourcingPolicy{
+		ID:   finding.SourcingPolicy.ID,
+		Name: finding.SourcingPolicy.Name,
+		Slug: finding.SourcingPolicy.Slug,
+	}
+	rule := provider.Rule{
+		Name:                 finding.Rule.Name,
+		Message:              finding.Rule.Message,
+		Confidence:           finding.Rule.Confidence,
+		Category:             finding.Rule.Category,
+		Subcategories:        finding.Rule.Subcategories,
+		VulnerabilityClasses: finding.Rule.VulnerabilityClasses,
+		CWENames:             finding.Rule.CWENames,
+		OWASPNames:           finding.Rule.OWASPNames,
+	}
+	project := projectsByName[finding.Repository.Name]
+	assistant := provider.Assistant{
+		Autofix:    finding.Assistant.Autofix,
+		Guidance:   finding.Assistant.Guidance,
+		Autotriage: finding.Assistant.Autotriage,
+		Component:  finding.Assistant.Component,
+	}
+	return models.Resource{
+		ID:   strconv.Itoa(finding.ID),
+		Name: strconv.Itoa(finding.ID),
+		IntegrationMetadata: provider.Metadata{
+			DeploymentID:   deployment.ID,
+			DeploymentSlug: deployment.Slug,
+			ProjectName:    finding.Repository.Name,
+			RepositoryURL:  finding.Repository.URL,
+			ProductType:    provider.FindingProductType,
+		},
+		Description: provider.FindingDescription{
+			ID:              finding.ID,
+			DeploymentID:    deployment.ID,
+			ProjectID:       project.ID,
+			ProjectTags:     project.Tags,
+			Ref:             finding.Ref,
+			FirstSeenScanID: strconv.Itoa(finding.FirstSeenScanID),
+			SyntacticID:     finding.SyntacticID,
+			MatchBasedID:    finding.MatchBasedID,
+			ExternalTicket:  externalTicket,
+			Repository:      repository,
+			LineOfCodeURL:   finding.LineOfCodeURL,
+			TriageState:     finding.TriageState,
+			State:           finding.State,
+			Status:          finding.Status,
+			Severity:        finding.Severity,
+			Confidence:      finding.Confidence,
+			Categories:      finding.Categories,
+			CreatedAt:       finding.CreatedAt,
+			RelevantSince:   finding.RelevantSince,
+			RuleName:        finding.RuleName,
+			RuleMessage:     finding.RuleMessage,
+			Location:        location,
+			SourcingPolicy:  sourcingPolicy,
+			TriagedAt:       finding.TriagedAt,
+			TriageComment:   finding.TriageComment,
+			TriageReason:    finding.TriageReason,
+			StateUpdatedAt:  finding.StateUpdatedAt,
+			Rule:            rule,
+			Assistant:       assistant,
+		},
 	}
-	return nil
 }
@@ -0,0 +1,131 @@
+package describers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
+	"github.com/opengovern/og-describer-semgrep/discovery/provider"
+	"golang.org/x/time/rate"
+)
+
+type roundTripFunc func(req *http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+// fakeSemgrepAPI answers with one deployment without projects whose findings fill a page and a half, the
+// findings pages requested are recorded
+func fakeSemgrepAPI(t *testing.T, requestedPages *[]string) *provider.SemGrepAPIHandler {
+	var lock sync.Mutex
+	handler := provider.NewSemGrepAPIHandler("token", rate.Inf, 1, 1, 0, time.Millisecond)
+	handler.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		var body any
+		switch {
+		case req.URL.Path == "/api/v1/deployments":
+			body = map[string]any{"deployments": []map[string]any{{"id": 1, "slug": "acme"}}}
+		case strings.HasSuffix(req.URL.Path, "/projects"):
+			body = map[string]any{"projects": []any{}}
+		case strings.HasSuffix(req.URL.Path, "/findings"):
+			page := req.URL.Query().Get("page")
+			lock.Lock()
+			*requestedPages = append(*requestedPages, page)
+			lock.Unlock()
+			findings := []map[string]any{}
+			switch page {
+			case "0":
+				for id := 0; id < 3000; id++ {
+					findings = append(findings, map[string]any{"id": id})
+				}
+			case "1":
+				findings = append(findings, map[string]any{"id": 3000})
+			}
+			body = map[string]any{"findings": findings}
+		default:
+			t.Errorf("unexpected request %s", req.URL)
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Header: http.Header{}}
+		}
+		content, _ := json.Marshal(body)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(string(content))), Header: http.Header{}}
+	})}
+	return handler
+}
+
+type memoryCheckpointStore struct {
+	checkpoints map[string]provider.Checkpoint
+}
+
+func (s *memoryCheckpointStore) Load(_ context.Context, key string) (*provider.Checkpoint, error) {
+	checkpoint, ok := s.checkpoints[key]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (s *memoryCheckpointStore) Save(_ context.Context, key string, checkpoint provider.Checkpoint) error {
+	s.checkpoints[key] = checkpoint
+	return nil
+}
+
+func (s *memoryCheckpointStore) Delete(_ context.Context, key string) error {
+	delete(s.checkpoints, key)
+	return nil
+}
+
+func TestListFindingsCheckpointsDeliveredPages(t *testing.T) {
+	store := &memoryCheckpointStore{checkpoints: make(map[string]provider.Checkpoint)}
+
+	var requestedPages []string
+	var streamed int
+	var events []string
+	stream := models.StreamSender(func(models.Resource) error {
+		streamed++
+		return nil
+	})
+
+	checkpoints := provider.NewCheckpoints(store, "key", 1, false)
+	checkpoints.SetFlush(func(context.Context) error {
+		events = append(events, fmt.Sprintf("flush after %d", streamed))
+		// the sink fails to deliver the findings of the second page
+		if streamed > 3000 {
+			return fmt.Errorf("resources spooled")
+		}
+		return nil
+	})
+	ctx := provider.WithCheckpoints(context.Background(), checkpoints)
+	if _, err := ListFindings(ctx, fakeSemgrepAPI(t, &requestedPages), &stream); err != nil {
+		t.Fatalf("list findings: %v", err)
+	}
+
+	// every page is flushed once all of its findings went through the stream
+	if fmt.Sprint(events) != "[flush after 3000 flush after 3001]" {
+		t.Fatalf("events %v, want a flush after each page", events)
+	}
+	checkpoint := store.checkpoints["key"]
+	if checkpoint.Deployment != "acme" || checkpoint.Page != 1 {
+		t.Fatalf("checkpoint %+v, want page 1 of acme as the second page was not delivered", checkpoint)
+	}
+
+	// the next attempt of the job resumes from the page that was not delivered
+	requestedPages, streamed = nil, 0
+	checkpoints = provider.NewCheckpoints(store, "key", 1, false)
+	ctx = provider.WithCheckpoints(context.Background(), checkpoints)
+	if _, err := ListFindings(ctx, fakeSemgrepAPI(t, &requestedPages), &stream); err != nil {
+		t.Fatalf("list findings: %v", err)
+	}
+	if fmt.Sprint(requestedPages) != "[1]" || streamed != 1 {
+		t.Fatalf("resumed with pages %v and %d findings, want page 1 with 1 finding", requestedPages, streamed)
+	}
+	if !checkpoints.Resumed() {
+		t.Fatal("the describe is not reported as resumed")
+	}
+}
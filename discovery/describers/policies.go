@@ -7,11 +7,14 @@ import (
 	"github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
 	"github.com/opengovern/og-describer-semgrep/discovery/provider"
 	"net/http"
-	"strconv"
 	"sync"
 )
 
 func ListPolicies(ctx context.Context, handler *provider.SemGrepAPIHandler, stream *models.StreamSender) ([]models.Resource, error) {
+	// stop paging the Semgrep API as soon as the consumer gives up, e.g. when the stream fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var wg sync.WaitGroup
 	semGrepChan := make(chan models.Resource)
 	errorChan := make(chan error, 1) // Buffered channel to capture errors
@@ -24,9 +27,17 @@ func ListPolicies(ctx context.Context, handler *provider.SemGrepAPIHandler, stre
 		defer close(semGrepChan)
 		defer close(errorChan)
 		for _, deployment := range deployments {
-			if err := processPolicies(ctx, handler, strconv.Itoa(deployment.ID), semGrepChan, &wg); err != nil {
-				errorChan <- err // Send error to the error channel
+			provider.GetProgressFromContext(ctx).SetLocation(deployment.Slug, "")
+			scope := provider.DeploymentScope(deployment.Slug)
+			provider.GetCoverageFromContext(ctx).Start(scope)
+			if err := processPolicies(ctx, handler, deployment, semGrepChan, &wg); err != nil {
+				select {
+				case errorChan <- err: // Send error to the error channel
+				case <-ctx.Done():
+				}
+				continue
 			}
+			provider.GetCoverageFromContext(ctx).Done(scope)
 		}
 		wg.Wait()
 	}()
@@ -36,6 +47,10 @@ func ListPolicies(ctx context.Context, handler *provider.SemGrepAPIHandler, stre
 		select {
 		case value, ok := <-semGrepChan:
 			if !ok {
+				// errorChan is closed first, an error sent right before the end must not be missed
+				if err := <-errorChan; err != nil {
+					return nil, err
+				}
 				return values, nil
 			}
 			if stream != nil {
@@ -51,33 +66,25 @@ func ListPolicies(ctx context.Context, handler *provider.SemGrepAPIHandler, stre
 	}
 }
 
-func processPolicies(ctx context.Context, handler *provider.SemGrepAPIHandler, deploymentID string, semGrepChan chan<- models.Resource, wg *sync.WaitGroup) error {
+func processPolicies(ctx context.Context, handler *provider.SemGrepAPIHandler, deployment provider.DeploymentJSON, semGrepChan chan<- models.Resource, wg *sync.WaitGroup) error {
 	var policyListResponse provider.PoliciesListResponse
-	var resp *http.Response
 	baseURL := "https://semgrep.dev/api/v1/deployments/"
 
-	finalURL := fmt.Sprintf("%s%s/policies", baseURL, deploymentID)
+	finalURL := fmt.Sprintf("%s%d/policies", baseURL, deployment.ID)
 
 	req, err := http.NewRequest("GET", finalURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	requestFunc := func(req *http.Request) (*http.Response, error) {
-		var e error
-		resp, e = handler.Client.Do(req)
-		if e != nil {
-			return nil, fmt.Errorf("request execution failed: %w", e)
+	decode := func(resp *http.Response) error {
+		if e := json.NewDecoder(resp.Body).Decode(&policyListResponse); e != nil {
+			return fmt.Errorf("failed to decode response: %w", e)
 		}
-		defer resp.Body.Close()
-
-		if e = json.NewDecoder(resp.Body).Decode(&policyListResponse); e != nil {
-			return nil, fmt.Errorf("failed to decode response: %w", e)
-		}
-		return resp, nil
+		return nil
 	}
 
-	err = handler.DoRequest(ctx, req, requestFunc)
+	err = handler.DoRequest(ctx, req, decode)
 	if err != nil {
 		return fmt.Errorf("error during request handling: %w", err)
 	}
@@ -89,15 +96,24 @@ func processPolicies(ctx context.Context, handler *provider.SemGrepAPIHandler, d
 			value := models.Resource{
 				ID:   policy.ID,
 				Name: policy.Name,
+				IntegrationMetadata: provider.Metadata{
+					DeploymentID:   deployment.ID,
+					DeploymentSlug: deployment.Slug,
+					ProductType:    policy.ProductType,
+				},
 				Description: provider.PolicyDescription{
-					ID:          policy.ID,
-					Name:        policy.Name,
-					Slug:        policy.Slug,
-					ProductType: policy.ProductType,
-					IsDefault:   policy.IsDefault,
+					ID:           policy.ID,
+					DeploymentID: deployment.ID,
+					Name:         policy.Name,
+					Slug:         policy.Slug,
+					ProductType:  policy.ProductType,
+					IsDefault:    policy.IsDefault,
 				},
 			}
-			semGrepChan <- value
+			select {
+			case semGrepChan <- value:
+			case <-ctx.Done():
+			}
 		}(policy)
 	}
 	return nil
@@ -13,6 +13,10 @@ import (
 )
 
 func ListProjects(ctx context.Context, handler *provider.SemGrepAPIHandler, stream *models.StreamSender) ([]models.Resource, error) {
+	// stop paging the Semgrep API as soon as the consumer gives up, e.g. when the stream fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var wg sync.WaitGroup
 	semGrepChan := make(chan models.Resource)
 	errorChan := make(chan error, 1) // Buffered channel to capture errors
@@ -25,9 +29,17 @@ func ListProjects(ctx context.Context, handler *provider.SemGrepAPIHandler, stre
 		defer close(semGrepChan)
 		defer close(errorChan)
 		for _, deployment := range deployments {
-			if err := processProjects(ctx, handler, deployment.Slug, semGrepChan, &wg); err != nil {
-				errorChan <- err // Send error to the error channel
+			provider.GetProgressFromContext(ctx).SetLocation(deployment.Slug, "")
+			scope := provider.DeploymentScope(deployment.Slug)
+			provider.GetCoverageFromContext(ctx).Start(scope)
+			if err := processProjects(ctx, handler, deployment, semGrepChan, &wg); err != nil {
+				select {
+				case errorChan <- err: // Send error to the error channel
+				case <-ctx.Done():
+				}
+				continue
 			}
+			provider.GetCoverageFromContext(ctx).Done(scope)
 		}
 		wg.Wait()
 	}()
@@ -37,6 +49,10 @@ func ListProjects(ctx context.Context, handler *provider.SemGrepAPIHandler, stre
 		select {
 		case value, ok := <-semGrepChan:
 			if !ok {
+				// errorChan is closed first, an error sent right before the end must not be missed
+				if err := <-errorChan; err != nil {
+					return nil, err
+				}
 				return values, nil
 			}
 			if stream != nil {
@@ -52,10 +68,9 @@ func ListProjects(ctx context.Context, handler *provider.SemGrepAPIHandler, stre
 	}
 }
 
-func processProjects(ctx context.Context, handler *provider.SemGrepAPIHandler, deploymentSlug string, semGrepChan chan<- models.Resource, wg *sync.WaitGroup) error {
+func processProjects(ctx context.Context, handler *provider.SemGrepAPIHandler, deployment provider.DeploymentJSON, semGrepChan chan<- models.Resource, wg *sync.WaitGroup) error {
 	var projects []provider.ProjectJSON
 	var projectListResponse provider.ProjectsListResponse
-	var resp *http.Response
 	baseURL := "https://semgrep.dev/api/v1/deployments/"
 	page := 0
 
@@ -63,29 +78,22 @@ func processProjects(ctx context.Context, handler *provider.SemGrepAPIHandler, d
 		params := url.Values{}
 		params.Set("page", strconv.Itoa(page))
 		params.Set("page_size", "3000")
-		finalURL := fmt.Sprintf("%s%s/projects?%s", baseURL, deploymentSlug, params.Encode())
+		finalURL := fmt.Sprintf("%s%s/projects?%s", baseURL, deployment.Slug, params.Encode())
 
 		req, err := http.NewRequest("GET", finalURL, nil)
 		if err != nil {
 			return fmt.Errorf("failed to create request: %w", err)
 		}
 
-		requestFunc := func(req *http.Request) (*http.Response, error) {
-			var e error
-			resp, e = handler.Client.Do(req)
-			if e != nil {
-				return nil, fmt.Errorf("request execution failed: %w", e)
-			}
-			defer resp.Body.Close()
-
-			if e = json.NewDecoder(resp.Body).Decode(&projectListResponse); e != nil {
-				return nil, fmt.Errorf("failed to decode response: %w", e)
+		decode := func(resp *http.Response) error {
+			if e := json.NewDecoder(resp.Body).Decode(&projectListResponse); e != nil {
+				return fmt.Errorf("failed to decode response: %w", e)
 			}
 			projects = append(projects, projectListResponse.Projects...)
-			return resp, nil
+			return nil
 		}
 
-		err = handler.DoRequest(ctx, req, requestFunc)
+		err = handler.DoRequest(ctx, req, decode)
 		if err != nil {
 			return fmt.Errorf("error during request handling: %w", err)
 		}
@@ -103,8 +111,15 @@ func processProjects(ctx context.Context, handler *provider.SemGrepAPIHandler, d
 			value := models.Resource{
 				ID:   strconv.Itoa(project.ID),
 				Name: project.Name,
+				IntegrationMetadata: provider.Metadata{
+					DeploymentID:   deployment.ID,
+					DeploymentSlug: deployment.Slug,
+					ProjectName:    project.Name,
+					RepositoryURL:  project.URL,
+				},
 				Description: provider.ProjectDescription{
 					ID:            project.ID,
+					DeploymentID:  deployment.ID,
 					Name:          project.Name,
 					URL:           project.URL,
 					Tags:          project.Tags,
@@ -114,7 +129,10 @@ func processProjects(ctx context.Context, handler *provider.SemGrepAPIHandler, d
 					DefaultBranch: project.DefaultBranch,
 				},
 			}
-			semGrepChan <- value
+			select {
+			case semGrepChan <- value:
+			case <-ctx.Done():
+			}
 		}(project)
 	}
 	return nil
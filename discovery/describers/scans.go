@@ -8,7 +8,6 @@ import (
 	"github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
 	"github.com/opengovern/og-describer-semgrep/discovery/provider"
 	"net/http"
-	"strconv"
 	"sync"
 )
 
@@ -17,6 +16,10 @@ type RequestBody struct {
 }
 
 func ListScans(ctx context.Context, handler *provider.SemGrepAPIHandler, stream *models.StreamSender) ([]models.Resource, error) {
+	// stop paging the Semgrep API as soon as the consumer gives up, e.g. when the stream fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	var wg sync.WaitGroup
 	semGrepChan := make(chan models.Resource)
 	errorChan := make(chan error, 1) // Buffered channel to capture errors
@@ -28,15 +31,31 @@ func ListScans(ctx context.Context, handler *provider.SemGrepAPIHandler, stream
 	go func() {
 		defer close(semGrepChan)
 		defer close(errorChan)
+		coverage := provider.GetCoverageFromContext(ctx)
 		for _, deployment := range deployments {
+			deploymentScope := provider.DeploymentScope(deployment.Slug)
+			coverage.Start(deploymentScope)
 			projects, err := provider.ListProjects(ctx, handler, deployment.Slug)
 			if err != nil {
-				errorChan <- err // Send error to the error channel
+				select {
+				case errorChan <- err: // Send error to the error channel
+				case <-ctx.Done():
+				}
+				continue
 			}
+			coverage.Done(deploymentScope)
 			for _, project := range projects {
-				if err := processScans(ctx, handler, strconv.Itoa(deployment.ID), project.ID, semGrepChan, &wg); err != nil {
-					errorChan <- err // Send error to the error channel
+				provider.GetProgressFromContext(ctx).SetLocation(deployment.Slug, project.Name)
+				projectScope := provider.ProjectScope(deployment.Slug, project.Name)
+				coverage.Start(projectScope)
+				if err := processScans(ctx, handler, deployment, project, semGrepChan, &wg); err != nil {
+					select {
+					case errorChan <- err: // Send error to the error channel
+					case <-ctx.Done():
+					}
+					continue
 				}
+				coverage.Done(projectScope)
 			}
 		}
 		wg.Wait()
@@ -47,6 +66,10 @@ func ListScans(ctx context.Context, handler *provider.SemGrepAPIHandler, stream
 		select {
 		case value, ok := <-semGrepChan:
 			if !ok {
+				// errorChan is closed first, an error sent right before the end must not be missed
+				if err := <-errorChan; err != nil {
+					return nil, err
+				}
 				return values, nil
 			}
 			if stream != nil {
@@ -62,15 +85,14 @@ func ListScans(ctx context.Context, handler *provider.SemGrepAPIHandler, stream
 	}
 }
 
-func processScans(ctx context.Context, handler *provider.SemGrepAPIHandler, deploymentID string, repositoryID int, semGrepChan chan<- models.Resource, wg *sync.WaitGroup) error {
+func processScans(ctx context.Context, handler *provider.SemGrepAPIHandler, deployment provider.DeploymentJSON, project provider.ProjectJSON, semGrepChan chan<- models.Resource, wg *sync.WaitGroup) error {
 	var scanListResponse provider.ScansListResponse
-	var resp *http.Response
 	baseURL := "https://semgrep.dev/api/v1/deployments/"
 
-	finalURL := fmt.Sprintf("%s%s/scans/search", baseURL, deploymentID)
+	finalURL := fmt.Sprintf("%s%d/scans/search", baseURL, deployment.ID)
 
 	body := RequestBody{
-		RepositoryID: repositoryID,
+		RepositoryID: project.ID,
 	}
 
 	requestData, err := json.Marshal(body)
@@ -83,21 +105,14 @@ func processScans(ctx context.Context, handler *provider.SemGrepAPIHandler, depl
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	requestFunc := func(req *http.Request) (*http.Response, error) {
-		var e error
-		resp, e = handler.Client.Do(req)
-		if e != nil {
-			return nil, fmt.Errorf("request execution failed: %w", e)
+	decode := func(resp *http.Response) error {
+		if e := json.NewDecoder(resp.Body).Decode(&scanListResponse); e != nil {
+			return fmt.Errorf("failed to decode response: %w", e)
 		}
-		defer resp.Body.Close()
-
-		if e = json.NewDecoder(resp.Body).Decode(&scanListResponse); e != nil {
-			return nil, fmt.Errorf("failed to decode response: %w", e)
-		}
-		return resp, nil
+		return nil
 	}
 
-	err = handler.DoRequest(ctx, req, requestFunc)
+	err = handler.DoRequest(ctx, req, decode)
 	if err != nil {
 		return fmt.Errorf("error during request handling: %w", err)
 	}
@@ -109,9 +124,17 @@ func processScans(ctx context.Context, handler *provider.SemGrepAPIHandler, depl
 			value := models.Resource{
 				ID:   scan.ID,
 				Name: scan.ID,
+				IntegrationMetadata: provider.Metadata{
+					DeploymentID:   deployment.ID,
+					DeploymentSlug: deployment.Slug,
+					ProjectName:    project.Name,
+					RepositoryURL:  project.URL,
+				},
 				Description: provider.ScanDescription{
 					ID:             scan.ID,
-					DeploymentID:   scan.DeploymentID,
+					DeploymentID:   deployment.ID,
+					ProjectID:      project.ID,
+					ProjectTags:    project.Tags,
 					RepositoryID:   scan.RepositoryID,
 					Branch:         scan.Branch,
 					Commit:         scan.Commit,
@@ -124,7 +147,10 @@ func processScans(ctx context.Context, handler *provider.SemGrepAPIHandler, depl
 					Status:         scan.Status,
 				},
 			}
-			semGrepChan <- value
+			select {
+			case semGrepChan <- value:
+			case <-ctx.Done():
+			}
 		}(scan)
 	}
 	return nil
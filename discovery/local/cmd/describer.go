@@ -3,20 +3,14 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/opengovern/og-describer-semgrep/global"
-	"os"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	model "github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
 	"github.com/opengovern/og-describer-semgrep/discovery/pkg/orchestrator"
 	"github.com/opengovern/og-describer-semgrep/discovery/provider"
 	"github.com/opengovern/og-util/pkg/describe"
-	"github.com/opengovern/og-util/pkg/es"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -24,20 +18,14 @@ import (
 var (
 	resourceType string
 	outputFile   string
+	stdout       bool
 )
 
 // describerCmd represents the describer command
 var describerCmd = &cobra.Command{
 	Use:   "describer",
 	Short: "A brief description of your command",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		// Open the output file
-		file, err := os.Create(outputFile)
-		if err != nil {
-			return fmt.Errorf("failed to create file: %w", err)
-		}
-		defer file.Close() // Ensure the file is closed at the end
-
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		job := describe.DescribeJob{
 			JobID:                  uint(uuid.New().ID()),
 			ResourceType:           resourceType,
@@ -62,80 +50,21 @@ var describerCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		plg := global.Plugin()
-
-		f := func(resource model.Resource) error {
-			if resource.Description == nil {
-				return nil
-			}
-			descriptionJSON, err := json.Marshal(resource.Description)
-			if err != nil {
-				return fmt.Errorf("failed to marshal description: %w", err)
-			}
-			descriptionJSON, err = trimJsonFromEmptyObjects(descriptionJSON)
-			if err != nil {
-				return fmt.Errorf("failed to trim json: %w", err)
-			}
-
-			metadata, err := provider.GetResourceMetadata(job, resource)
-			if err != nil {
-				return fmt.Errorf("failed to get resource metadata")
-			}
-			err = provider.AdjustResource(job, &resource)
-			if err != nil {
-				return fmt.Errorf("failed to adjust resource metadata")
-			}
-
-			desc := resource.Description
-			err = json.Unmarshal(descriptionJSON, &desc)
-			if err != nil {
-				return fmt.Errorf("unmarshal description: %v", err.Error())
-			}
-
-			if plg != nil {
-				_, _, err = global.ExtractTagsAndNames(logger, plg, job.ResourceType, resource)
-				if err != nil {
-					logger.Error("failed to build tags for service", zap.Error(err), zap.String("resourceType", job.ResourceType), zap.Any("resource", resource))
-				}
-			}
-
-			var description any
-			err = json.Unmarshal([]byte(descriptionJSON), &description)
-			if err != nil {
-				logger.Error("failed to parse resource description json", zap.Error(err))
-				return fmt.Errorf("failed to parse resource description json")
-			}
-
-			res := es.Resource{
-				PlatformID:      fmt.Sprintf("%s:::%s:::%s", job.IntegrationID, job.ResourceType, resource.UniqueID()),
-				ResourceID:      resource.UniqueID(),
-				ResourceName:    resource.Name,
-				Description:     description,
-				IntegrationType: global.IntegrationName,
-				ResourceType:    strings.ToLower(job.ResourceType),
-				IntegrationID:   job.IntegrationID,
-				Metadata:        metadata,
-				DescribedAt:     job.DescribedAt,
-				DescribedBy:     strconv.FormatUint(uint64(job.JobID), 10),
-			}
-
-			// Write the resource JSON to the file
-			resJSON, err := json.Marshal(res)
-			if err != nil {
-				return fmt.Errorf("failed to marshal resource JSON: %w", err)
-			}
-			_, err = file.Write(resJSON)
-			if err != nil {
-				return fmt.Errorf("failed to write to file: %w", err)
-			}
-			_, err = file.Write([]byte(",\n")) // Add a newline for readability
-			if err != nil {
-				return fmt.Errorf("failed to write newline to file: %w", err)
+		sink, err := newResourceSink()
+		if err != nil {
+			return err
+		}
+		// flushed and closed on failures too, the resources described before the error are kept
+		defer func() {
+			if finishErr := sink.Finish(ctx); err == nil {
+				err = finishErr
 			}
+		}()
 
-			return nil
+		pipeline, err := orchestrator.NewResourcePipeline(logger, job)
+		if err != nil {
+			return err
 		}
-		clientStream := (*model.StreamSender)(&f)
 
 		err = orchestrator.GetResources(
 			ctx,
@@ -144,7 +73,7 @@ var describerCmd = &cobra.Command{
 			job.TriggerType,
 			creds,
 			additionalParameters,
-			clientStream,
+			pipeline.StreamSender(ctx, sink),
 		)
 		if err != nil {
 			return err
@@ -155,29 +84,14 @@ var describerCmd = &cobra.Command{
 
 func init() {
 	describerCmd.Flags().StringVar(&resourceType, "resourceType", "", "Resource type")
-	describerCmd.Flags().StringVar(&outputFile, "outputFile", "output.json", "File to write JSON outputs")
-}
-
-func trimJsonFromEmptyObjects(input []byte) ([]byte, error) {
-	unknownData := map[string]any{}
-	err := json.Unmarshal(input, &unknownData)
-	if err != nil {
-		return nil, err
-	}
-	trimEmptyMaps(unknownData)
-	return json.Marshal(unknownData)
+	describerCmd.Flags().StringVar(&outputFile, "outputFile", "output.json", "File to write NDJSON outputs")
+	describerCmd.Flags().BoolVar(&stdout, "stdout", false, "Write NDJSON outputs to stdout instead of the output file")
 }
 
-func trimEmptyMaps(input map[string]any) {
-	for key, value := range input {
-		switch value.(type) {
-		case map[string]any:
-			if len(value.(map[string]any)) != 0 {
-				trimEmptyMaps(value.(map[string]any))
-			}
-			if len(value.(map[string]any)) == 0 {
-				delete(input, key)
-			}
-		}
+// newResourceSink writes the described resources as NDJSON to the output file, or to stdout when requested
+func newResourceSink() (orchestrator.ResourceSink, error) {
+	if stdout {
+		return orchestrator.NewStdoutSink(), nil
 	}
+	return orchestrator.NewFileSink(outputFile)
 }
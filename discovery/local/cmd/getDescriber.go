@@ -1,21 +1,15 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
-	model "github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
 	"github.com/opengovern/og-describer-semgrep/discovery/pkg/orchestrator"
 	"github.com/opengovern/og-describer-semgrep/discovery/provider"
 	"github.com/opengovern/og-describer-semgrep/global"
 	"github.com/opengovern/og-util/pkg/describe"
-	"github.com/opengovern/og-util/pkg/es"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
-	"os"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -27,14 +21,7 @@ var (
 var getDescriberCmd = &cobra.Command{
 	Use:   "getDescriber",
 	Short: "A brief description of your command",
-	RunE: func(cmd *cobra.Command, args []string) error {
-		// Open the output file
-		file, err := os.Create(outputFile)
-		if err != nil {
-			return fmt.Errorf("failed to create file: %w", err)
-		}
-		defer file.Close() // Ensure the file is closed at the end
-
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		job := describe.DescribeJob{
 			JobID:                  uint(uuid.New().ID()),
 			ResourceType:           resourceType,
@@ -59,80 +46,21 @@ var getDescriberCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		plg := global.Plugin()
-
-		f := func(resource model.Resource) error {
-			if resource.Description == nil {
-				return nil
-			}
-			descriptionJSON, err := json.Marshal(resource.Description)
-			if err != nil {
-				return fmt.Errorf("failed to marshal description: %w", err)
-			}
-			descriptionJSON, err = trimJsonFromEmptyObjects(descriptionJSON)
-			if err != nil {
-				return fmt.Errorf("failed to trim json: %w", err)
-			}
-
-			metadata, err := provider.GetResourceMetadata(job, resource)
-			if err != nil {
-				return fmt.Errorf("failed to get resource metadata")
-			}
-			err = provider.AdjustResource(job, &resource)
-			if err != nil {
-				return fmt.Errorf("failed to adjust resource metadata")
-			}
-
-			desc := resource.Description
-			err = json.Unmarshal(descriptionJSON, &desc)
-			if err != nil {
-				return fmt.Errorf("unmarshal description: %v", err.Error())
-			}
-
-			if plg != nil {
-				_, _, err = global.ExtractTagsAndNames(logger, plg, job.ResourceType, resource)
-				if err != nil {
-					logger.Error("failed to build tags for service", zap.Error(err), zap.String("resourceType", job.ResourceType), zap.Any("resource", resource))
-				}
-			}
-
-			var description any
-			err = json.Unmarshal([]byte(descriptionJSON), &description)
-			if err != nil {
-				logger.Error("failed to parse resource description json", zap.Error(err))
-				return fmt.Errorf("failed to parse resource description json")
-			}
-
-			res := es.Resource{
-				PlatformID:      fmt.Sprintf("%s:::%s:::%s", job.IntegrationID, job.ResourceType, resource.UniqueID()),
-				ResourceID:      resource.UniqueID(),
-				ResourceName:    resource.Name,
-				Description:     description,
-				IntegrationType: global.IntegrationName,
-				ResourceType:    strings.ToLower(job.ResourceType),
-				IntegrationID:   job.IntegrationID,
-				Metadata:        metadata,
-				DescribedAt:     job.DescribedAt,
-				DescribedBy:     strconv.FormatUint(uint64(job.JobID), 10),
-			}
-
-			// Write the resource JSON to the file
-			resJSON, err := json.Marshal(res)
-			if err != nil {
-				return fmt.Errorf("failed to marshal resource JSON: %w", err)
-			}
-			_, err = file.Write(resJSON)
-			if err != nil {
-				return fmt.Errorf("failed to write to file: %w", err)
-			}
-			_, err = file.Write([]byte(",\n")) // Add a newline for readability
-			if err != nil {
-				return fmt.Errorf("failed to write newline to file: %w", err)
+		sink, err := newResourceSink()
+		if err != nil {
+			return err
+		}
+		// flushed and closed on failures too, the resource described before the error is kept
+		defer func() {
+			if finishErr := sink.Finish(ctx); err == nil {
+				err = finishErr
 			}
+		}()
 
-			return nil
+		pipeline, err := orchestrator.NewResourcePipeline(logger, job)
+		if err != nil {
+			return err
 		}
-		clientStream := (*model.StreamSender)(&f)
 
 		err = orchestrator.GetSingleResource(
 			ctx,
@@ -142,17 +70,15 @@ var getDescriberCmd = &cobra.Command{
 			creds,
 			additionalParameters,
 			resourceID,
-			clientStream,
+			pipeline.StreamSender(ctx, sink),
 		)
-		if err != nil {
-			return err
-		}
-		return nil
+		return err
 	},
 }
 
 func init() {
 	getDescriberCmd.Flags().StringVar(&resourceType, "resourceType", "", "Resource type")
 	getDescriberCmd.Flags().StringVar(&resourceID, "resourceID", "", "Resource ID")
-	getDescriberCmd.Flags().StringVar(&outputFile, "outputFile", "output.json", "File to write JSON outputs")
+	getDescriberCmd.Flags().StringVar(&outputFile, "outputFile", "output.json", "File to write NDJSON outputs")
+	getDescriberCmd.Flags().BoolVar(&stdout, "stdout", false, "Write NDJSON outputs to stdout instead of the output file")
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/opengovern/og-describer-semgrep/discovery/pkg"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
@@ -25,9 +26,14 @@ func main() {
 	go func() {
 		select {
 		case <-c:
+			// the worker stops taking jobs and lets the running ones finish, a second signal exits right away
 			cancel()
 		case <-ctx.Done():
+			return
 		}
+		<-c
+		fmt.Println("forced shutdown")
+		os.Exit(1)
 	}()
 
 	if err := WorkerCommand().ExecuteContext(ctx); err != nil {
@@ -37,6 +43,8 @@ func main() {
 }
 
 func WorkerCommand() *cobra.Command {
+	var configFile string
+	config := pkg.DefaultWorkerConfig()
 	cmd := &cobra.Command{
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
@@ -46,17 +54,48 @@ func WorkerCommand() *cobra.Command {
 				return err
 			}
 
+			config, err := pkg.LoadWorkerConfig(configFile, cmd.Flags())
+			if err != nil {
+				return err
+			}
+			logger.Info("worker config", zap.Any("config", config.Redacted()))
+
+			listener, err := net.Listen("tcp", config.HTTP.Address)
+			if err != nil {
+				return fmt.Errorf("failed to listen for the health and metrics server: %w", err)
+			}
+			defer listener.Close()
+
 			w, err := pkg.NewWorker(
 				logger,
 				cmd.Context(),
+				config,
 			)
 			if err != nil {
 				return err
 			}
 
-			return w.Run(ctx)
+			// the server outlives ctx so the jobs finishing on shutdown stay observable
+			serverCtx, stopServer := context.WithCancel(context.WithoutCancel(ctx))
+			defer stopServer()
+			server := pkg.NewServer(logger, listener, w)
+			serverErr := make(chan error, 1)
+			go func() {
+				serverErr <- server.Run(serverCtx)
+			}()
+
+			err = w.Run(ctx)
+			stopServer()
+			if serr := <-serverErr; serr != nil {
+				logger.Error("health and metrics server failed", zap.Error(serr))
+			}
+			return err
 		},
 	}
 
+	cmd.Flags().StringVar(&configFile, "config", os.Getenv("WORKER_CONFIG_FILE"), "YAML file with the worker config, the environment and the flags override it")
+	config.RegisterFlags(cmd.Flags())
+	cmd.AddCommand(DeadLetterCommand())
+
 	return cmd
 }
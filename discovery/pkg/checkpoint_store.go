@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/opengovern/og-describer-semgrep/discovery/provider"
+)
+
+const CheckpointBucket = "og_describer_semgrep_checkpoints"
+
+// KVCheckpointStore keeps the describe checkpoints in a KV bucket so a retry on any worker resumes them, the
+// bucket TTL drops the checkpoints of the jobs that were never retried
+type KVCheckpointStore struct {
+	kv jetstream.KeyValue
+}
+
+func NewKVCheckpointStore(ctx context.Context, js jetstream.JetStream, ttl time.Duration) (*KVCheckpointStore, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      CheckpointBucket,
+		Description: "progress of the paginated describe jobs",
+		TTL:         ttl,
+		History:     1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint bucket: %w", err)
+	}
+	return &KVCheckpointStore{kv: kv}, nil
+}
+
+func (s *KVCheckpointStore) Load(ctx context.Context, key string) (*provider.Checkpoint, error) {
+	entry, err := s.kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+
+	var checkpoint provider.Checkpoint
+	if err = json.Unmarshal(entry.Value(), &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return &checkpoint, nil
+}
+
+func (s *KVCheckpointStore) Save(ctx context.Context, key string, checkpoint provider.Checkpoint) error {
+	value, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if _, err = s.kv.Put(ctx, key, value); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (s *KVCheckpointStore) Delete(ctx context.Context, key string) error {
+	err := s.kv.Delete(ctx, key)
+	if err != nil && !errors.Is(err, jetstream.ErrKeyNotFound) {
+		return fmt.Errorf("failed to delete checkpoint: %w", err)
+	}
+	return nil
+}
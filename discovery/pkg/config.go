@@ -0,0 +1,330 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/opengovern/og-describer-semgrep/discovery/pkg/orchestrator"
+	"github.com/opengovern/og-describer-semgrep/discovery/provider"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const redactedSecret = "[redacted]"
+
+// WorkerConfig everything the describe worker can be tuned with, later sources override the earlier ones:
+// the defaults, the YAML file, the environment and the flags
+type WorkerConfig struct {
+	NATS       NATSConfig         `yaml:"nats"`
+	Jobs       JobsConfig         `yaml:"jobs"`
+	SemgrepAPI provider.APILimits `yaml:"semgrepAPI"`
+	HTTP       HTTPConfig         `yaml:"http"`
+	Auth       AuthConfig         `yaml:"auth"`
+	Vault      VaultConfig        `yaml:"vault"`
+	// GRPCTLS how the connections to the platform services are secured
+	GRPCTLS orchestrator.GrpcTLSConfig `yaml:"grpcTLS"`
+	// Ingest how the resources are delivered, the undelivered ones are spooled on disk for replay
+	Ingest orchestrator.IngestConfig `yaml:"ingest"`
+}
+
+type NATSConfig struct {
+	URL string `yaml:"url"`
+}
+
+type JobsConfig struct {
+	Concurrency int `yaml:"concurrency"`
+	// ManualConcurrency and ScheduledConcurrency cap the jobs of each queue within Concurrency, 0 lets a queue
+	// use every slot. Manual jobs take the free slots first
+	ManualConcurrency    int `yaml:"manualConcurrency"`
+	ScheduledConcurrency int `yaml:"scheduledConcurrency"`
+	// MemoryLimitMiB memory the jobs may use, 0 falls back to GOMEMLIMIT
+	MemoryLimitMiB      uint64        `yaml:"memoryLimitMiB"`
+	Timeout             time.Duration `yaml:"timeout"`
+	AckWait             time.Duration `yaml:"ackWait"`
+	ShutdownGracePeriod time.Duration `yaml:"shutdownGracePeriod"`
+	// LeaseTTL how long the lease of a job outlives a worker that stopped renewing it
+	LeaseTTL time.Duration `yaml:"leaseTTL"`
+	// CheckpointTTL how long a failed job can be resumed from where it stopped
+	CheckpointTTL time.Duration `yaml:"checkpointTTL"`
+}
+
+type HTTPConfig struct {
+	Address string `yaml:"address"`
+}
+
+type AuthConfig struct {
+	// JWTPrivateKey base64 encoded PEM RSA key signing the tokens sent to the platform
+	JWTPrivateKey string `yaml:"jwtPrivateKey"`
+}
+
+type VaultConfig struct {
+	// AllowLocal lets the jobs read their credentials from the files and the environment of the worker with the
+	// local vault, only for development
+	AllowLocal bool `yaml:"allowLocal"`
+}
+
+func DefaultWorkerConfig() WorkerConfig {
+	return WorkerConfig{
+		Jobs: JobsConfig{
+			Concurrency:         1,
+			Timeout:             25 * time.Minute,
+			AckWait:             30 * time.Minute,
+			ShutdownGracePeriod: 5 * time.Minute,
+			LeaseTTL:            2 * time.Minute,
+			CheckpointTTL:       24 * time.Hour,
+		},
+		SemgrepAPI: provider.DefaultAPILimits,
+		Ingest:     orchestrator.DefaultIngestConfig,
+		HTTP: HTTPConfig{
+			Address: ":8080",
+		},
+	}
+}
+
+// RegisterFlags binds the flags of the worker command to c, their defaults are the values of c
+func (c *WorkerConfig) RegisterFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.NATS.URL, "nats-url", c.NATS.URL, "NATS server URL (NATS_URL)")
+	flags.IntVar(&c.Jobs.Concurrency, "concurrency", c.Jobs.Concurrency, "Number of describe jobs run at the same time (JOB_CONCURRENCY)")
+	flags.IntVar(&c.Jobs.ManualConcurrency, "manual-concurrency", c.Jobs.ManualConcurrency, "Manually triggered jobs run at the same time, 0 for no own limit (MANUAL_JOB_CONCURRENCY)")
+	flags.IntVar(&c.Jobs.ScheduledConcurrency, "scheduled-concurrency", c.Jobs.ScheduledConcurrency, "Scheduled jobs run at the same time, 0 for no own limit (SCHEDULED_JOB_CONCURRENCY)")
+	flags.Uint64Var(&c.Jobs.MemoryLimitMiB, "memory-limit", c.Jobs.MemoryLimitMiB, "Memory in MiB the jobs may use, 0 falls back to GOMEMLIMIT (JOB_MEMORY_LIMIT)")
+	flags.DurationVar(&c.Jobs.Timeout, "job-timeout", c.Jobs.Timeout, "Time a describe job may run (JOB_TIMEOUT)")
+	flags.DurationVar(&c.Jobs.AckWait, "ack-wait", c.Jobs.AckWait, "Time without heartbeat after which NATS delivers a job again (JOB_ACK_WAIT)")
+	flags.DurationVar(&c.Jobs.ShutdownGracePeriod, "shutdown-grace-period", c.Jobs.ShutdownGracePeriod, "How long the running jobs get to finish on shutdown (SHUTDOWN_GRACE_PERIOD)")
+	flags.DurationVar(&c.Jobs.LeaseTTL, "job-lease-ttl", c.Jobs.LeaseTTL, "How long the lease of a job outlives a worker that died (JOB_LEASE_TTL)")
+	flags.DurationVar(&c.Jobs.CheckpointTTL, "job-checkpoint-ttl", c.Jobs.CheckpointTTL, "How long a failed job can be resumed from its checkpoint (JOB_CHECKPOINT_TTL)")
+	flags.IntVar(&c.SemgrepAPI.RequestsPerMinute, "semgrep-requests-per-minute", c.SemgrepAPI.RequestsPerMinute, "Semgrep API requests per minute (SEMGREP_API_REQUESTS_PER_MINUTE)")
+	flags.IntVar(&c.SemgrepAPI.Concurrency, "semgrep-concurrency", c.SemgrepAPI.Concurrency, "Semgrep API requests in flight (SEMGREP_API_CONCURRENCY)")
+	flags.IntVar(&c.SemgrepAPI.MaxRetries, "semgrep-max-retries", c.SemgrepAPI.MaxRetries, "Retries of a failed Semgrep API request (SEMGREP_API_MAX_RETRIES)")
+	flags.DurationVar(&c.SemgrepAPI.RetryBackoff, "semgrep-retry-backoff", c.SemgrepAPI.RetryBackoff, "Initial backoff between Semgrep API retries (SEMGREP_API_RETRY_BACKOFF)")
+	flags.StringVar(&c.HTTP.Address, "http-address", c.HTTP.Address, "Address of the health and metrics server (HTTP_ADDRESS)")
+	flags.StringVar(&c.GRPCTLS.CACertFile, "grpc-tls-ca-file", c.GRPCTLS.CACertFile, "PEM bundle trusted for the platform gRPC services on top of the system roots (GRPC_TLS_CA_FILE)")
+	flags.StringVar(&c.GRPCTLS.ServerName, "grpc-tls-server-name", c.GRPCTLS.ServerName, "Name the platform gRPC certificates are verified against (GRPC_TLS_SERVER_NAME)")
+	flags.StringVar(&c.GRPCTLS.ClientCertFile, "grpc-tls-cert-file", c.GRPCTLS.ClientCertFile, "Client certificate for mTLS with the platform gRPC services (GRPC_TLS_CERT_FILE)")
+	flags.StringVar(&c.GRPCTLS.ClientKeyFile, "grpc-tls-key-file", c.GRPCTLS.ClientKeyFile, "Client key for mTLS with the platform gRPC services (GRPC_TLS_KEY_FILE)")
+	flags.BoolVar(&c.GRPCTLS.InsecureSkipVerify, "grpc-tls-insecure-skip-verify", c.GRPCTLS.InsecureSkipVerify, "Do not verify the platform gRPC certificates, development only (GRPC_TLS_INSECURE_SKIP_VERIFY)")
+	flags.StringVar(&c.Ingest.SpoolDir, "ingest-spool-dir", c.Ingest.SpoolDir, "Directory keeping the resources that could not be delivered for replay (INGEST_SPOOL_DIR)")
+	flags.Int64Var(&c.Ingest.SpoolMaxMiB, "ingest-spool-max-size", c.Ingest.SpoolMaxMiB, "Size in MiB of the resources kept for replay (INGEST_SPOOL_MAX_SIZE)")
+	flags.StringVar(&c.Ingest.Compression, "ingest-compression", c.Ingest.Compression, "Compressor of the Ingest calls, none to send them uncompressed (INGEST_GRPC_COMPRESSION)")
+	flags.DurationVar(&c.Ingest.SpoolMaxAge, "ingest-spool-max-age", c.Ingest.SpoolMaxAge, "How long the spooled resources of a job that does not run again are kept (INGEST_SPOOL_MAX_AGE)")
+	flags.BoolVar(&c.Vault.AllowLocal, "allow-local-vault", c.Vault.AllowLocal, "Let the jobs read their credentials from the worker files and environment, development only (ALLOW_LOCAL_VAULT)")
+}
+
+// LoadWorkerConfig builds the config from the defaults, the YAML file at path if any, the environment and the
+// flags of flags that were set, then validates it
+func LoadWorkerConfig(path string, flags *pflag.FlagSet) (WorkerConfig, error) {
+	c := DefaultWorkerConfig()
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return c, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err = yaml.Unmarshal(content, &c); err != nil {
+			return c, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := c.loadEnv(); err != nil {
+		return c, err
+	}
+
+	if flags != nil {
+		// the flags are bound to another config, only the ones set on the command line are applied
+		bound := pflag.NewFlagSet("config", pflag.ContinueOnError)
+		c.RegisterFlags(bound)
+		var err error
+		flags.Visit(func(f *pflag.Flag) {
+			if bound.Lookup(f.Name) == nil || err != nil {
+				return
+			}
+			err = bound.Set(f.Name, f.Value.String())
+		})
+		if err != nil {
+			return c, err
+		}
+	}
+
+	return c, c.Validate()
+}
+
+func (c *WorkerConfig) loadEnv() error {
+	var errs []error
+	envString(&c.NATS.URL, "NATS_URL")
+	errs = append(errs,
+		envInt(&c.Jobs.Concurrency, "JOB_CONCURRENCY"),
+		envInt(&c.Jobs.ManualConcurrency, "MANUAL_JOB_CONCURRENCY"),
+		envInt(&c.Jobs.ScheduledConcurrency, "SCHEDULED_JOB_CONCURRENCY"),
+		envUint(&c.Jobs.MemoryLimitMiB, "JOB_MEMORY_LIMIT"),
+		envDuration(&c.Jobs.Timeout, "JOB_TIMEOUT"),
+		envDuration(&c.Jobs.AckWait, "JOB_ACK_WAIT"),
+		envDuration(&c.Jobs.ShutdownGracePeriod, "SHUTDOWN_GRACE_PERIOD"),
+		envDuration(&c.Jobs.LeaseTTL, "JOB_LEASE_TTL"),
+		envDuration(&c.Jobs.CheckpointTTL, "JOB_CHECKPOINT_TTL"),
+		envInt(&c.SemgrepAPI.RequestsPerMinute, "SEMGREP_API_REQUESTS_PER_MINUTE"),
+		envInt(&c.SemgrepAPI.Concurrency, "SEMGREP_API_CONCURRENCY"),
+		envInt(&c.SemgrepAPI.MaxRetries, "SEMGREP_API_MAX_RETRIES"),
+		envDuration(&c.SemgrepAPI.RetryBackoff, "SEMGREP_API_RETRY_BACKOFF"),
+		envInt64(&c.Ingest.SpoolMaxMiB, "INGEST_SPOOL_MAX_SIZE"),
+		envDuration(&c.Ingest.SpoolMaxAge, "INGEST_SPOOL_MAX_AGE"),
+		envBool(&c.Vault.AllowLocal, "ALLOW_LOCAL_VAULT"),
+		envBool(&c.GRPCTLS.InsecureSkipVerify, "GRPC_TLS_INSECURE_SKIP_VERIFY"),
+	)
+	envString(&c.GRPCTLS.CACertFile, "GRPC_TLS_CA_FILE")
+	envString(&c.GRPCTLS.ServerName, "GRPC_TLS_SERVER_NAME")
+	envString(&c.GRPCTLS.ClientCertFile, "GRPC_TLS_CERT_FILE")
+	envString(&c.GRPCTLS.ClientKeyFile, "GRPC_TLS_KEY_FILE")
+	envString(&c.Ingest.SpoolDir, "INGEST_SPOOL_DIR")
+	envString(&c.Ingest.Compression, "INGEST_GRPC_COMPRESSION")
+	envString(&c.HTTP.Address, "HTTP_ADDRESS")
+	envString(&c.Auth.JWTPrivateKey, "JWT_PRIVATE_KEY")
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once
+func (c WorkerConfig) Validate() error {
+	var errs []error
+	if c.NATS.URL == "" {
+		errs = append(errs, errors.New("nats url is required"))
+	} else if _, err := url.Parse(c.NATS.URL); err != nil {
+		errs = append(errs, fmt.Errorf("invalid nats url: %w", err))
+	}
+	if c.Jobs.Concurrency < 1 {
+		errs = append(errs, errors.New("job concurrency must be at least 1"))
+	}
+	if c.Jobs.ManualConcurrency < 0 || c.Jobs.ScheduledConcurrency < 0 {
+		errs = append(errs, errors.New("queue concurrency can not be negative"))
+	}
+	if c.Jobs.Timeout <= 0 {
+		errs = append(errs, errors.New("job timeout must be positive"))
+	}
+	if c.Jobs.AckWait <= 0 {
+		errs = append(errs, errors.New("ack wait must be positive"))
+	}
+	if c.Jobs.ShutdownGracePeriod <= 0 {
+		errs = append(errs, errors.New("shutdown grace period must be positive"))
+	}
+	if c.Jobs.LeaseTTL < time.Second {
+		errs = append(errs, errors.New("job lease ttl must be at least 1s"))
+	}
+	if c.Jobs.CheckpointTTL < time.Second {
+		errs = append(errs, errors.New("job checkpoint ttl must be at least 1s"))
+	}
+	if c.SemgrepAPI.RequestsPerMinute < 1 {
+		errs = append(errs, errors.New("semgrep api requests per minute must be at least 1"))
+	}
+	if c.SemgrepAPI.Concurrency < 1 {
+		errs = append(errs, errors.New("semgrep api concurrency must be at least 1"))
+	}
+	if c.SemgrepAPI.MaxRetries < 0 {
+		errs = append(errs, errors.New("semgrep api max retries can not be negative"))
+	}
+	if c.SemgrepAPI.RetryBackoff <= 0 {
+		errs = append(errs, errors.New("semgrep api retry backoff must be positive"))
+	}
+	if err := c.GRPCTLS.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Ingest.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.HTTP.Address == "" {
+		errs = append(errs, errors.New("http address is required"))
+	}
+	if c.Auth.JWTPrivateKey != "" {
+		if _, err := base64.StdEncoding.DecodeString(c.Auth.JWTPrivateKey); err != nil {
+			errs = append(errs, errors.New("jwt private key is not base64 encoded"))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid worker config: %w", err)
+	}
+	return nil
+}
+
+// Redacted a copy of the config safe to log, without the secrets nor the password of the NATS URL
+func (c WorkerConfig) Redacted() WorkerConfig {
+	if c.Auth.JWTPrivateKey != "" {
+		c.Auth.JWTPrivateKey = redactedSecret
+	}
+	if u, err := url.Parse(c.NATS.URL); err == nil && u.User != nil {
+		c.NATS.URL = u.Redacted()
+	}
+	return c
+}
+
+func envString(value *string, name string) {
+	if v, ok := os.LookupEnv(name); ok && v != "" {
+		*value = v
+	}
+}
+
+func envInt(value *int, name string) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", name, v)
+	}
+	*value = i
+	return nil
+}
+
+func envUint(value *uint64, name string) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	i, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", name, v)
+	}
+	*value = i
+	return nil
+}
+
+func envInt64(value *int64, name string) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", name, v)
+	}
+	*value = i
+	return nil
+}
+
+func envBool(value *bool, name string) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", name, v)
+	}
+	*value = b
+	return nil
+}
+
+func envDuration(value *time.Duration, name string) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", name, v)
+	}
+	*value = d
+	return nil
+}
@@ -0,0 +1,170 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/opengovern/og-describer-semgrep/global"
+	"strconv"
+	"time"
+)
+
+const (
+	DeadLetterHeaderSubject      = "Og-Dead-Letter-Subject"
+	DeadLetterHeaderReason       = "Og-Dead-Letter-Reason"
+	DeadLetterHeaderError        = "Og-Dead-Letter-Error"
+	DeadLetterHeaderDeliveries   = "Og-Dead-Letter-Deliveries"
+	DeadLetterHeaderRetryCounter = "Og-Dead-Letter-Retry-Counter"
+	DeadLetterHeaderWorkerID     = "Og-Dead-Letter-Worker-Id"
+	DeadLetterHeaderFailedAt     = "Og-Dead-Letter-Failed-At"
+
+	DeadLetterReasonMalformed = "malformed"
+	DeadLetterReasonPermanent = "permanent-failure"
+	DeadLetterReasonExhausted = "attempts-exhausted"
+)
+
+// DeadLetter a job parked on global.DeadLetterTopic, Sequence identifies it in the stream
+type DeadLetter struct {
+	Sequence     uint64
+	Subject      string
+	Reason       string
+	Error        string
+	Deliveries   uint64
+	RetryCounter uint
+	WorkerID     string
+	FailedAt     time.Time
+	Data         []byte
+}
+
+// DeadLetterQueue parks the describe jobs that can not be processed so they can be inspected and requeued,
+// it has its own connection so the dead-letter commands can use it without a worker
+type DeadLetterQueue struct {
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+func NewDeadLetterQueue(url string) (*DeadLetterQueue, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &DeadLetterQueue{conn: conn, js: js}, nil
+}
+
+// Connected whether the connection to the NATS server is up
+func (q *DeadLetterQueue) Connected() bool {
+	return q.conn.IsConnected()
+}
+
+func (q *DeadLetterQueue) Close() {
+	q.conn.Close()
+}
+
+// Publish copies the message to the dead-letter subject with headers describing the failure
+func (q *DeadLetterQueue) Publish(ctx context.Context, msg jetstream.Msg, reason string, cause error, retryCounter uint, workerID string) error {
+	deadLetter := nats.NewMsg(global.DeadLetterTopic)
+	deadLetter.Data = msg.Data()
+	deadLetter.Header.Set(DeadLetterHeaderSubject, msg.Subject())
+	deadLetter.Header.Set(DeadLetterHeaderReason, reason)
+	if cause != nil {
+		deadLetter.Header.Set(DeadLetterHeaderError, cause.Error())
+	}
+	if metadata, err := msg.Metadata(); err == nil {
+		deadLetter.Header.Set(DeadLetterHeaderDeliveries, strconv.FormatUint(metadata.NumDelivered, 10))
+	}
+	deadLetter.Header.Set(DeadLetterHeaderRetryCounter, strconv.FormatUint(uint64(retryCounter), 10))
+	deadLetter.Header.Set(DeadLetterHeaderWorkerID, workerID)
+	deadLetter.Header.Set(DeadLetterHeaderFailedAt, time.Now().UTC().Format(time.RFC3339))
+
+	_, err := q.js.PublishMsg(ctx, deadLetter)
+	return err
+}
+
+// List returns up to limit dead-lettered jobs, oldest first
+func (q *DeadLetterQueue) List(ctx context.Context, limit int) ([]DeadLetter, error) {
+	stream, err := q.js.Stream(ctx, global.StreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	state := stream.CachedInfo().State
+	if state.Msgs == 0 {
+		return []DeadLetter{}, nil
+	}
+
+	var deadLetters []DeadLetter
+	seq := state.FirstSeq
+	for limit <= 0 || len(deadLetters) < limit {
+		msg, err := stream.GetMsg(ctx, seq, jetstream.WithGetMsgSubject(global.DeadLetterTopic))
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, newDeadLetter(msg))
+		seq = msg.Sequence + 1
+	}
+	return deadLetters, nil
+}
+
+func (q *DeadLetterQueue) Get(ctx context.Context, seq uint64) (*DeadLetter, error) {
+	stream, err := q.js.Stream(ctx, global.StreamName)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := stream.GetMsg(ctx, seq)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Subject != global.DeadLetterTopic {
+		return nil, fmt.Errorf("message %d is not a dead letter", seq)
+	}
+	deadLetter := newDeadLetter(msg)
+	return &deadLetter, nil
+}
+
+// Requeue publishes the job back on the subject it failed on and removes it from the dead letters
+func (q *DeadLetterQueue) Requeue(ctx context.Context, seq uint64) error {
+	deadLetter, err := q.Get(ctx, seq)
+	if err != nil {
+		return err
+	}
+	if deadLetter.Subject == "" {
+		return fmt.Errorf("dead letter %d does not record its original subject", seq)
+	}
+
+	if _, err = q.js.Publish(ctx, deadLetter.Subject, deadLetter.Data); err != nil {
+		return fmt.Errorf("failed to requeue: %w", err)
+	}
+
+	stream, err := q.js.Stream(ctx, global.StreamName)
+	if err != nil {
+		return err
+	}
+	return stream.DeleteMsg(ctx, seq)
+}
+
+func newDeadLetter(msg *jetstream.RawStreamMsg) DeadLetter {
+	deliveries, _ := strconv.ParseUint(msg.Header.Get(DeadLetterHeaderDeliveries), 10, 64)
+	retryCounter, _ := strconv.ParseUint(msg.Header.Get(DeadLetterHeaderRetryCounter), 10, 64)
+	failedAt, _ := time.Parse(time.RFC3339, msg.Header.Get(DeadLetterHeaderFailedAt))
+	return DeadLetter{
+		Sequence:     msg.Sequence,
+		Subject:      msg.Header.Get(DeadLetterHeaderSubject),
+		Reason:       msg.Header.Get(DeadLetterHeaderReason),
+		Error:        msg.Header.Get(DeadLetterHeaderError),
+		Deliveries:   deliveries,
+		RetryCounter: uint(retryCounter),
+		WorkerID:     msg.Header.Get(DeadLetterHeaderWorkerID),
+		FailedAt:     failedAt,
+		Data:         msg.Data,
+	}
+}
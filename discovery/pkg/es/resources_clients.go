@@ -306,6 +306,7 @@ func (p ProjectPaginator) NextPage(ctx context.Context) ([]Project, error) {
 var listProjectFilters = map[string]string{
 	"created_at":     "Description.CreatedAt",
 	"default_branch": "Description.DefaultBranch",
+	"deployment_id":  "Description.DeploymentID",
 	"id":             "Description.ID",
 	"latest_scan_at": "Description.LatestScanAt",
 	"name":           "Description.Name",
@@ -377,6 +378,7 @@ func ListProject(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData
 var getProjectFilters = map[string]string{
 	"created_at":     "Description.CreatedAt",
 	"default_branch": "Description.DefaultBranch",
+	"deployment_id":  "Description.DeploymentID",
 	"id":             "Description.ID",
 	"latest_scan_at": "Description.LatestScanAt",
 	"name":           "Description.Name",
@@ -521,11 +523,12 @@ func (p PolicyPaginator) NextPage(ctx context.Context) ([]Policy, error) {
 }
 
 var listPolicyFilters = map[string]string{
-	"id":           "Description.ID",
-	"is_default":   "Description.IsDefault",
-	"name":         "Description.Name",
-	"product_type": "Description.ProductType",
-	"slug":         "Description.Slug",
+	"deployment_id": "Description.DeploymentID",
+	"id":            "Description.ID",
+	"is_default":    "Description.IsDefault",
+	"name":          "Description.Name",
+	"product_type":  "Description.ProductType",
+	"slug":          "Description.Slug",
 }
 
 func ListPolicy(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
@@ -589,11 +592,12 @@ func ListPolicy(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData)
 }
 
 var getPolicyFilters = map[string]string{
-	"id":           "Description.ID",
-	"is_default":   "Description.IsDefault",
-	"name":         "Description.Name",
-	"product_type": "Description.ProductType",
-	"slug":         "Description.Slug",
+	"deployment_id": "Description.DeploymentID",
+	"id":            "Description.ID",
+	"is_default":    "Description.IsDefault",
+	"name":          "Description.Name",
+	"product_type":  "Description.ProductType",
+	"slug":          "Description.Slug",
 }
 
 func GetPolicy(ctx context.Context, d *plugin.QueryData, _ *plugin.HydrateData) (interface{}, error) {
@@ -740,6 +744,8 @@ var listScanFilters = map[string]string{
 	"findings_counts": "Description.FindingsCounts",
 	"id":              "Description.ID",
 	"is_full_scan":    "Description.IsFullScan",
+	"project_id":      "Description.ProjectID",
+	"project_tags":    "Description.ProjectTags",
 	"repository_id":   "Description.RepositoryID",
 	"started_at":      "Description.StartedAt",
 	"status":          "Description.Status",
@@ -815,6 +821,8 @@ var getScanFilters = map[string]string{
 	"findings_counts": "Description.FindingsCounts",
 	"id":              "Description.ID",
 	"is_full_scan":    "Description.IsFullScan",
+	"project_id":      "Description.ProjectID",
+	"project_tags":    "Description.ProjectTags",
 	"repository_id":   "Description.RepositoryID",
 	"started_at":      "Description.StartedAt",
 	"status":          "Description.Status",
@@ -961,12 +969,15 @@ var listFindingFilters = map[string]string{
 	"categories":         "Description.Categories",
 	"confidence":         "Description.Confidence",
 	"created_at":         "Description.CreatedAt",
+	"deployment_id":      "Description.DeploymentID",
 	"external_ticket":    "Description.ExternalTicket",
 	"first_seen_scan_id": "Description.FirstSeenScanID",
 	"id":                 "Description.ID",
 	"line_of_code_url":   "Description.LineOfCodeURL",
 	"location":           "Description.Location",
 	"match_based_id":     "Description.MatchBasedID",
+	"project_id":         "Description.ProjectID",
+	"project_tags":       "Description.ProjectTags",
 	"ref":                "Description.Ref",
 	"relevant_since":     "Description.RelevantSince",
 	"repository":         "Description.Repository",
@@ -1046,12 +1057,15 @@ var getFindingFilters = map[string]string{
 	"categories":         "Description.Categories",
 	"confidence":         "Description.Confidence",
 	"created_at":         "Description.CreatedAt",
+	"deployment_id":      "Description.DeploymentID",
 	"external_ticket":    "Description.ExternalTicket",
 	"first_seen_scan_id": "Description.FirstSeenScanID",
 	"id":                 "Description.ID",
 	"line_of_code_url":   "Description.LineOfCodeURL",
 	"location":           "Description.Location",
 	"match_based_id":     "Description.MatchBasedID",
+	"project_id":         "Description.ProjectID",
+	"project_tags":       "Description.ProjectTags",
 	"ref":                "Description.Ref",
 	"relevant_since":     "Description.RelevantSince",
 	"repository":         "Description.Repository",
@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// Server exposes the health, readiness and prometheus metrics of a worker
+type Server struct {
+	logger   *zap.Logger
+	worker   *Worker
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewServer serves on listener, it is listened on before the worker starts so a bad address fails the startup
+func NewServer(logger *zap.Logger, listener net.Listener, worker *Worker) *Server {
+	s := &Server{logger: logger, worker: worker, listener: listener}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.Handle("/metrics", promhttp.Handler())
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Run serves until ctx is done
+func (s *Server) Run(ctx context.Context) error {
+	errChan := make(chan error, 1)
+	go func() {
+		s.logger.Info("serving health and metrics", zap.String("address", s.listener.Addr().String()))
+		errChan <- s.server.Serve(s.listener)
+	}()
+
+	select {
+	case err := <-errChan:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(shutdownCtx)
+}
+
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (s *Server) readyz(w http.ResponseWriter, _ *http.Request) {
+	if err := s.worker.Ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+func TestServerReportsDisconnectedWorkerNotReady(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	// connections that never connected, the worker is consuming but can not reach NATS
+	w := &Worker{conn: &nats.Conn{}, deadLetters: &DeadLetterQueue{conn: &nats.Conn{}}}
+	w.setConsuming(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- NewServer(zap.NewNop(), listener, w).Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("run: %v", err)
+		}
+	})
+
+	for path, want := range map[string]int{
+		"/healthz": http.StatusOK,
+		"/readyz":  http.StatusServiceUnavailable,
+	} {
+		resp, err := http.Get("http://" + listener.Addr().String() + path)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("%s answered %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+}
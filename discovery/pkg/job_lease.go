@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+const (
+	JobLeaseBucket = "og_describer_semgrep_job_leases"
+	// JobLeaseRenewRatio the lease is renewed every TTL / JobLeaseRenewRatio
+	JobLeaseRenewRatio = 3
+)
+
+// ErrJobLeased the job is already running on this or another worker
+var ErrJobLeased = errors.New("job is already running")
+
+// DuplicateJobError the message is a duplicate delivery of a job that is already running
+type DuplicateJobError struct {
+	error
+}
+
+func (e DuplicateJobError) Unwrap() error {
+	return e.error
+}
+
+type jobLeaseValue struct {
+	JobID      uint      `json:"job_id"`
+	WorkerID   string    `json:"worker_id"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// JobLeases makes a job run at most once at a time across the workers with a lease per job ID in a KV bucket,
+// the bucket TTL expires the leases of the workers that died without releasing them
+type JobLeases struct {
+	logger   *zap.Logger
+	kv       jetstream.KeyValue
+	ttl      time.Duration
+	workerID string
+}
+
+func NewJobLeases(ctx context.Context, logger *zap.Logger, js jetstream.JetStream, ttl time.Duration, workerID string) (*JobLeases, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      JobLeaseBucket,
+		Description: "leases of the running describe jobs",
+		TTL:         ttl,
+		History:     1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job lease bucket: %w", err)
+	}
+	return &JobLeases{logger: logger, kv: kv, ttl: ttl, workerID: workerID}, nil
+}
+
+// JobLease a held lease, renewed in the background until released
+type JobLease struct {
+	leases   *JobLeases
+	key      string
+	value    []byte
+	revision uint64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Acquire takes the lease of the job, ErrJobLeased when another delivery of the job holds it. lost is called
+// when the lease could not be renewed and another worker may have taken the job over
+func (l *JobLeases) Acquire(ctx context.Context, jobID uint, lost func(error)) (*JobLease, error) {
+	value, err := json.Marshal(jobLeaseValue{JobID: jobID, WorkerID: l.workerID, AcquiredAt: time.Now().UTC()})
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("job-%d", jobID)
+	revision, err := l.kv.Create(ctx, key, value)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return nil, ErrJobLeased
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire job lease: %w", err)
+	}
+
+	renewCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	lease := &JobLease{
+		leases:   l,
+		key:      key,
+		value:    value,
+		revision: revision,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go lease.renew(renewCtx, lost)
+	return lease, nil
+}
+
+func (l *JobLease) renew(ctx context.Context, lost func(error)) {
+	defer close(l.done)
+
+	t := time.NewTicker(l.leases.ttl / JobLeaseRenewRatio)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		updateCtx, cancel := context.WithTimeout(ctx, l.leases.ttl/JobLeaseRenewRatio)
+		revision, err := l.leases.kv.Update(updateCtx, l.key, l.value, l.revision)
+		cancel()
+		if err == nil {
+			l.revision = revision
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			// expired, it is still ours unless another delivery took it meanwhile
+			createCtx, cancel := context.WithTimeout(ctx, l.leases.ttl/JobLeaseRenewRatio)
+			revision, err = l.leases.kv.Create(createCtx, l.key, l.value)
+			cancel()
+			if err == nil {
+				l.revision = revision
+				continue
+			}
+			if errors.Is(err, jetstream.ErrKeyExists) {
+				lost(fmt.Errorf("job lease lost: %w", err))
+				return
+			}
+		}
+		// the lease survives until its TTL, the next tick tries again
+		l.leases.logger.Warn("failed to renew job lease", zap.String("key", l.key), zap.Error(err))
+	}
+}
+
+// Release stops renewing the lease and deletes it unless another delivery took it over
+func (l *JobLease) Release() {
+	l.cancel()
+	<-l.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := l.leases.kv.Delete(ctx, l.key, jetstream.LastRevision(l.revision))
+	if err != nil {
+		l.leases.logger.Warn("failed to release job lease, it expires on its own", zap.String("key", l.key), zap.Error(err))
+	}
+}
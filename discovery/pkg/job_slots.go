@@ -0,0 +1,297 @@
+package pkg
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// MemoryAdmissionRatio new jobs wait while the heap in use is above this share of the memory limit
+	MemoryAdmissionRatio = 0.7
+	// SlotWaitInterval how often a waiting job checks again and tells the queue it is still alive
+	SlotWaitInterval = 5 * time.Second
+)
+
+// jobSlots limits how many describe jobs run at once, overall and per queue, gives the free slots to the
+// queues in priority order, runs the jobs of an integration one at a time (they share the Semgrep token and
+// its rate limit) and holds new jobs back while memory is short. The integration is locked before a slot is
+// taken so a job waiting for its integration does not keep a slot from the others
+type jobSlots struct {
+	logger      *zap.Logger
+	memoryLimit uint64
+
+	lock     sync.Mutex
+	capacity int
+	running  int
+	// queues in priority order
+	queues []*queueSlots
+	// changed is closed and replaced whenever a slot is freed or a waiting job gives up
+	changed      chan struct{}
+	integrations map[string]*integrationLock
+	// parked jobs waiting for their integration aside from their queue, at most capacity
+	parked int
+}
+
+// integrationLock lets one job of an integration run at a time, refs counts the jobs holding or waiting for it
+// and the lock is forgotten with the last one
+type integrationLock struct {
+	semaphore chan struct{}
+	refs      int
+}
+
+type queueSlots struct {
+	name    string
+	limit   int
+	running int
+	waiting int
+}
+
+// newJobSlots queues are given by name in priority order with their own limit, a limit of 0 or above
+// concurrency is capped to concurrency
+func newJobSlots(logger *zap.Logger, concurrency int, memoryLimit uint64, queues []jobQueue) *jobSlots {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	s := &jobSlots{
+		logger:       logger,
+		memoryLimit:  memoryLimit,
+		capacity:     concurrency,
+		changed:      make(chan struct{}),
+		integrations: make(map[string]*integrationLock),
+	}
+	for _, queue := range queues {
+		limit := queue.concurrency
+		if limit <= 0 || limit > concurrency {
+			limit = concurrency
+		}
+		s.queues = append(s.queues, &queueSlots{name: queue.name, limit: limit})
+	}
+	return s
+}
+
+// jobMemoryLimit memory the jobs may use in bytes, GOMEMLIMIT when limitMiB is 0, 0 disables the memory
+// aware admission
+func jobMemoryLimit(limitMiB uint64) uint64 {
+	if limitMiB > 0 {
+		return limitMiB * 1024 * 1024
+	}
+	if limit := debug.SetMemoryLimit(-1); limit > 0 && limit != math.MaxInt64 {
+		return uint64(limit)
+	}
+	return 0
+}
+
+// acquire waits for a free slot of the queue and enough memory, heartbeat is called while waiting
+func (s *jobSlots) acquire(ctx context.Context, queue string, heartbeat func()) error {
+	if err := s.waitSlot(ctx, queue, heartbeat); err != nil {
+		return err
+	}
+
+	collected := false
+	for !s.memoryAvailable() {
+		if !collected {
+			// the heap may mostly be garbage left by the previous jobs
+			runtime.GC()
+			collected = true
+			continue
+		}
+		s.logger.Info("waiting for memory before starting the job", zap.Uint64("memoryLimit", s.memoryLimit))
+		heartbeat()
+		select {
+		case <-ctx.Done():
+			s.release(queue)
+			return ctx.Err()
+		case <-time.After(SlotWaitInterval):
+		}
+	}
+	return nil
+}
+
+func (s *jobSlots) waitSlot(ctx context.Context, queue string, heartbeat func()) error {
+	t := time.NewTicker(SlotWaitInterval)
+	defer t.Stop()
+
+	s.lock.Lock()
+	q := s.queue(queue)
+	q.waiting++
+	for {
+		if s.canStart(q) {
+			q.waiting--
+			q.running++
+			s.running++
+			s.lock.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-t.C:
+			heartbeat()
+		case <-ctx.Done():
+			s.lock.Lock()
+			q.waiting--
+			// a lower priority queue may have been held back by this job
+			s.broadcast()
+			s.lock.Unlock()
+			return ctx.Err()
+		}
+		s.lock.Lock()
+	}
+}
+
+// canStart a job of q starts when a slot is free, q is under its limit and no queue of higher priority has a
+// job waiting that could take the slot, s.lock must be held
+func (s *jobSlots) canStart(q *queueSlots) bool {
+	if s.running >= s.capacity || q.running >= q.limit {
+		return false
+	}
+	for _, other := range s.queues {
+		if other == q {
+			return true
+		}
+		if other.waiting > 0 && other.running < other.limit {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *jobSlots) release(queue string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	q := s.queue(queue)
+	q.running--
+	s.running--
+	s.broadcast()
+}
+
+// limit the number of jobs of the queue that may run at once
+func (s *jobSlots) limit(queue string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.queue(queue).limit
+}
+
+// queue unknown queues get the lowest priority and the overall limit, s.lock must be held
+func (s *jobSlots) queue(name string) *queueSlots {
+	for _, q := range s.queues {
+		if q.name == name {
+			return q
+		}
+	}
+	q := &queueSlots{name: name, limit: s.capacity}
+	s.queues = append(s.queues, q)
+	return q
+}
+
+// broadcast wakes the waiting jobs up, s.lock must be held
+func (s *jobSlots) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// memoryAvailable a job running alone is always admitted, it can not wait for anything else to finish
+func (s *jobSlots) memoryAvailable() bool {
+	s.lock.Lock()
+	running := s.running
+	s.lock.Unlock()
+	if s.memoryLimit == 0 || running <= 1 {
+		return true
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return float64(m.HeapInuse) < MemoryAdmissionRatio*float64(s.memoryLimit)
+}
+
+// tryLockIntegration locks the integration unless another job of it runs, the returned function releases it
+func (s *jobSlots) tryLockIntegration(integrationID string) (func(), bool) {
+	lock := s.refIntegration(integrationID)
+	select {
+	case lock.semaphore <- struct{}{}:
+		return s.unlockIntegration(integrationID, lock), true
+	default:
+		s.unrefIntegration(integrationID, lock)
+		return nil, false
+	}
+}
+
+// lockIntegration waits until no other job of the integration runs, the returned function releases it
+func (s *jobSlots) lockIntegration(ctx context.Context, integrationID string, heartbeat func()) (func(), error) {
+	lock := s.refIntegration(integrationID)
+	if err := wait(ctx, lock.semaphore, heartbeat); err != nil {
+		s.unrefIntegration(integrationID, lock)
+		return nil, err
+	}
+	return s.unlockIntegration(integrationID, lock), nil
+}
+
+func (s *jobSlots) unlockIntegration(integrationID string, lock *integrationLock) func() {
+	return func() {
+		<-lock.semaphore
+		s.unrefIntegration(integrationID, lock)
+	}
+}
+
+func (s *jobSlots) refIntegration(integrationID string) *integrationLock {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	lock, ok := s.integrations[integrationID]
+	if !ok {
+		lock = &integrationLock{semaphore: make(chan struct{}, 1)}
+		s.integrations[integrationID] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (s *jobSlots) unrefIntegration(integrationID string, lock *integrationLock) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(s.integrations, integrationID)
+	}
+}
+
+// park reserves a place for a job waiting for its integration aside from its queue, false when as many jobs as
+// there are slots wait already
+func (s *jobSlots) park() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.parked >= s.capacity {
+		return false
+	}
+	s.parked++
+	return true
+}
+
+func (s *jobSlots) unpark() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.parked--
+}
+
+// wait takes a place in the semaphore, calling heartbeat every SlotWaitInterval until it gets it
+func wait(ctx context.Context, semaphore chan struct{}, heartbeat func()) error {
+	t := time.NewTicker(SlotWaitInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case semaphore <- struct{}{}:
+			return nil
+		case <-t.C:
+			heartbeat()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestJobSlots(concurrency int, queues ...jobQueue) *jobSlots {
+	return newJobSlots(zap.NewNop(), concurrency, 0, queues)
+}
+
+// acquireAsync acquires a slot of queue in the background, the result is sent on the returned channel
+func acquireAsync(s *jobSlots, ctx context.Context, queue string) <-chan error {
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- s.acquire(ctx, queue, func() {})
+	}()
+	return acquired
+}
+
+func waitWaiting(t *testing.T, s *jobSlots, queue string, waiting int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.lock.Lock()
+		n := s.queue(queue).waiting
+		s.lock.Unlock()
+		if n == waiting {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d jobs of %s waiting, want %d", n, queue, waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestJobSlotsGiveFreedSlotToHigherPriorityQueue(t *testing.T) {
+	s := newTestJobSlots(1, jobQueue{name: JobQueueManual}, jobQueue{name: JobQueueScheduled})
+	if err := s.acquire(context.Background(), JobQueueScheduled, func() {}); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	scheduled := acquireAsync(s, context.Background(), JobQueueScheduled)
+	waitWaiting(t, s, JobQueueScheduled, 1)
+	manual := acquireAsync(s, context.Background(), JobQueueManual)
+	waitWaiting(t, s, JobQueueManual, 1)
+
+	s.release(JobQueueScheduled)
+	select {
+	case err := <-manual:
+		if err != nil {
+			t.Fatalf("manual acquire: %v", err)
+		}
+	case <-scheduled:
+		t.Fatal("the scheduled job took the slot before the manual one")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no job took the freed slot")
+	}
+
+	s.release(JobQueueManual)
+	if err := <-scheduled; err != nil {
+		t.Fatalf("scheduled acquire: %v", err)
+	}
+}
+
+func TestJobSlotsQueueLimit(t *testing.T) {
+	s := newTestJobSlots(2, jobQueue{name: JobQueueManual}, jobQueue{name: JobQueueScheduled, concurrency: 1})
+	if err := s.acquire(context.Background(), JobQueueScheduled, func() {}); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(ctx, JobQueueScheduled, func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire over the queue limit returned %v, want a deadline error", err)
+	}
+	if err := s.acquire(context.Background(), JobQueueManual, func() {}); err != nil {
+		t.Fatalf("the other queue could not use the free slot: %v", err)
+	}
+}
+
+func TestJobSlotsLockIntegration(t *testing.T) {
+	s := newTestJobSlots(2)
+
+	unlock, ok := s.tryLockIntegration("a")
+	if !ok {
+		t.Fatal("could not lock a free integration")
+	}
+	if _, ok = s.tryLockIntegration("a"); ok {
+		t.Fatal("locked an integration twice")
+	}
+	unlockOther, ok := s.tryLockIntegration("b")
+	if !ok {
+		t.Fatal("another integration is locked too")
+	}
+	unlockOther()
+
+	locked := make(chan func(), 1)
+	go func() {
+		unlock, err := s.lockIntegration(context.Background(), "a", func() {})
+		if err != nil {
+			t.Errorf("lock integration: %v", err)
+		}
+		locked <- unlock
+	}()
+	select {
+	case <-locked:
+		t.Fatal("locked an integration held by another job")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+
+	select {
+	case unlock = <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiting job did not get the integration")
+	}
+	unlock()
+
+	if n := len(s.integrations); n != 0 {
+		t.Fatalf("%d integrations left after every job released them", n)
+	}
+}
+
+func TestJobSlotsLockIntegrationCancelled(t *testing.T) {
+	s := newTestJobSlots(1)
+	unlock, _ := s.tryLockIntegration("a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.lockIntegration(ctx, "a", func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lock integration returned %v, want a deadline error", err)
+	}
+	unlock()
+
+	if n := len(s.integrations); n != 0 {
+		t.Fatalf("%d integrations left after the waiting job gave up", n)
+	}
+}
+
+func TestJobSlotsParkIsBounded(t *testing.T) {
+	s := newTestJobSlots(2)
+	if !s.park() || !s.park() {
+		t.Fatal("could not park as many jobs as there are slots")
+	}
+	if s.park() {
+		t.Fatal("parked more jobs than there are slots")
+	}
+	s.unpark()
+	if !s.park() {
+		t.Fatal("could not park after a job was unparked")
+	}
+}
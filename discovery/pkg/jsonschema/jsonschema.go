@@ -0,0 +1,218 @@
+package jsonschema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	Draft = "https://json-schema.org/draft/2020-12/schema"
+
+	// TagName struct tag used to tune the generated schema, `jsonschema:"required"` marks a field
+	// that must be present and not hold its zero value
+	TagName = "jsonschema"
+)
+
+// Schema is the subset of JSON Schema needed to describe the resource descriptions
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+}
+
+// Generate builds the schema of the given go type the same way encoding/json would marshal it
+func Generate(t reflect.Type) *Schema {
+	s := generate(t)
+	s.SchemaURI = Draft
+	s.Title = t.Name()
+	return s
+}
+
+func generate(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := generate(t.Elem())
+		s.Type = nullable(s.Type)
+		return s
+	case reflect.Struct:
+		s := &Schema{
+			Type:       "object",
+			Properties: make(map[string]*Schema),
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag, ok := field.Tag.Lookup("json"); ok {
+				tagName, _, _ := strings.Cut(tag, ",")
+				if tagName == "-" {
+					continue
+				}
+				if tagName != "" {
+					name = tagName
+				}
+			}
+
+			fieldSchema := generate(field.Type)
+			if hasOption(field.Tag.Get(TagName), "required") {
+				s.Required = append(s.Required, name)
+				setNonZero(fieldSchema, field.Type)
+			}
+			s.Properties[name] = fieldSchema
+		}
+		sort.Strings(s.Required)
+		return s
+	case reflect.Map:
+		return &Schema{Type: nullable("object"), AdditionalProperties: generate(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: nullable("array"), Items: generate(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	default:
+		return &Schema{}
+	}
+}
+
+func setNonZero(s *Schema, t reflect.Type) {
+	switch t.Kind() {
+	case reflect.String:
+		minLength := 1
+		s.MinLength = &minLength
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		minimum := float64(1)
+		s.Minimum = &minimum
+	}
+}
+
+func nullable(t any) any {
+	switch v := t.(type) {
+	case string:
+		return []string{v, "null"}
+	default:
+		return t
+	}
+}
+
+func hasOption(tag, option string) bool {
+	for _, o := range strings.Split(tag, ",") {
+		if strings.TrimSpace(o) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks a decoded json value (as produced by json.Unmarshal into an any) against the schema
+// and returns every violation found, an empty result means the value is valid
+func (s *Schema) Validate(value any) []string {
+	var violations []string
+	s.validate("$", value, &violations)
+	return violations
+}
+
+func (s *Schema) validate(path string, value any, violations *[]string) {
+	if s == nil {
+		return
+	}
+	if !s.allowsType(value) {
+		*violations = append(*violations, fmt.Sprintf("%s: expected %v, got %s", path, s.Type, jsonType(value)))
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*violations = append(*violations, fmt.Sprintf("%s.%s: required property is missing", path, name))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property := v[name]
+			if propertySchema, ok := s.Properties[name]; ok {
+				propertySchema.validate(path+"."+name, property, violations)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(path+"."+name, property, violations)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, violations)
+		}
+	case string:
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			*violations = append(*violations, fmt.Sprintf("%s: must be at least %d characters long", path, *s.MinLength))
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			*violations = append(*violations, fmt.Sprintf("%s: must be greater than or equal to %v", path, *s.Minimum))
+		}
+	}
+}
+
+func (s *Schema) allowsType(value any) bool {
+	var types []string
+	switch t := s.Type.(type) {
+	case nil:
+		return true
+	case string:
+		types = []string{t}
+	case []string:
+		types = t
+	}
+
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
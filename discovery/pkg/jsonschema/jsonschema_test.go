@@ -0,0 +1,168 @@
+package jsonschema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opengovern/og-describer-semgrep/discovery/pkg/jsonschema"
+	"github.com/opengovern/og-describer-semgrep/global"
+	"github.com/opengovern/og-describer-semgrep/global/maps"
+)
+
+type owner struct {
+	Name  string `json:"name" jsonschema:"required"`
+	Email string `json:"email"`
+}
+
+type project struct {
+	ID       int               `json:"id" jsonschema:"required"`
+	Name     string            `json:"name" jsonschema:"required"`
+	Archived bool              `json:"archived"`
+	Score    float64           `json:"score"`
+	Owner    owner             `json:"owner"`
+	Manager  *owner            `json:"manager"`
+	Deleted  *string           `json:"deleted_at"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Internal string            `json:"-"`
+	hidden   string
+}
+
+func TestGenerate(t *testing.T) {
+	s := jsonschema.Generate(reflect.TypeOf(project{}))
+
+	tests := []struct {
+		name string
+		got  any
+		want string
+	}{
+		{name: "title", got: s.Title, want: "project"},
+		{name: "type", got: s.Type, want: "object"},
+		{name: "required", got: s.Required, want: "[id name]"},
+		{name: "integer", got: s.Properties["id"].Type, want: "integer"},
+		{name: "required integer minimum", got: *s.Properties["id"].Minimum, want: "1"},
+		{name: "required string min length", got: *s.Properties["name"].MinLength, want: "1"},
+		{name: "optional string", got: s.Properties["owner"].Properties["email"].MinLength == nil, want: "true"},
+		{name: "boolean", got: s.Properties["archived"].Type, want: "boolean"},
+		{name: "number", got: s.Properties["score"].Type, want: "number"},
+		{name: "nested struct", got: s.Properties["owner"].Type, want: "object"},
+		{name: "nested required", got: s.Properties["owner"].Required, want: "[name]"},
+		{name: "nullable struct pointer", got: s.Properties["manager"].Type, want: "[object null]"},
+		{name: "nullable string pointer", got: s.Properties["deleted_at"].Type, want: "[string null]"},
+		{name: "slice", got: s.Properties["tags"].Type, want: "[array null]"},
+		{name: "slice items", got: s.Properties["tags"].Items.Type, want: "string"},
+		{name: "map", got: s.Properties["labels"].Type, want: "[object null]"},
+		{name: "map values", got: s.Properties["labels"].AdditionalProperties.Type, want: "string"},
+		{name: "skipped fields", got: len(s.Properties), want: "9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(tt.got); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := jsonschema.Generate(reflect.TypeOf(project{}))
+
+	tests := []struct {
+		name string
+		json string
+		want []string
+	}{
+		{
+			name: "valid",
+			json: `{"id":1,"name":"app","archived":false,"score":0.5,"owner":{"name":"a"},"manager":null,"deleted_at":null,"tags":["x"],"labels":{"k":"v"}}`,
+		},
+		{
+			name: "missing required",
+			json: `{"owner":{}}`,
+			want: []string{"$.id: required property is missing", "$.name: required property is missing", "$.owner.name: required property is missing"},
+		},
+		{
+			name: "zero required",
+			json: `{"id":0,"name":""}`,
+			want: []string{"$.id: must be greater than or equal to 1", "$.name: must be at least 1 characters long"},
+		},
+		{
+			name: "type mismatch",
+			json: `{"id":"1","name":"app","archived":"yes","score":"high","tags":[1]}`,
+			want: []string{"$.archived: expected boolean, got string", "$.id: expected integer, got string", "$.score: expected number, got string", "$.tags[0]: expected string, got integer"},
+		},
+		{
+			name: "integer as number",
+			json: `{"id":1,"name":"app","score":1}`,
+		},
+		{
+			name: "fraction as integer",
+			json: `{"id":1.5,"name":"app"}`,
+			want: []string{"$.id: expected integer, got number"},
+		},
+		{
+			name: "null not nullable",
+			json: `{"id":1,"name":"app","owner":null}`,
+			want: []string{"$.owner: expected object, got null"},
+		},
+		{
+			name: "nullable pointer set",
+			json: `{"id":1,"name":"app","manager":{"email":"a@b.c"},"deleted_at":"2024-01-01"}`,
+			want: []string{"$.manager.name: required property is missing"},
+		},
+		{
+			name: "map values",
+			json: `{"id":1,"name":"app","labels":{"k":1}}`,
+			want: []string{"$.labels.k: expected string, got integer"},
+		},
+		{
+			name: "not an object",
+			json: `[]`,
+			want: []string{"$: expected object, got array"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			if err := json.Unmarshal([]byte(tt.json), &value); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if got := s.Validate(value); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("violations %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestGeneratedSchemasAreUpToDate regenerates the description schemas the way json_schema_generator does and
+// compares them with the checked-in ones
+func TestGeneratedSchemasAreUpToDate(t *testing.T) {
+	dir := filepath.Join("..", "..", "..", "global", "maps", "schemas")
+	for resourceType, table := range maps.ResourceTypesToTables {
+		t.Run(resourceType, func(t *testing.T) {
+			schema, err := global.DescriptionSchema(resourceType)
+			if err != nil {
+				t.Fatalf("description schema: %v", err)
+			}
+			schema.Title = resourceType
+			generated, err := json.MarshalIndent(schema, "", "  ")
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			generated = append(generated, '\n')
+
+			checkedIn, err := os.ReadFile(filepath.Join(dir, table+".schema.json"))
+			if err != nil {
+				t.Fatalf("read checked-in schema: %v", err)
+			}
+			if !bytes.Equal(generated, checkedIn) {
+				t.Fatalf("%s.schema.json is out of date, run go run ./discovery/pkg/runable/json_schema_generator", table)
+			}
+		})
+	}
+}
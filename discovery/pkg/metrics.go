@@ -0,0 +1,30 @@
+package pkg
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	JobStatusSucceeded    = "succeeded"
+	JobStatusFailed       = "failed"
+	JobStatusRequeued     = "requeued"
+	JobStatusDeadLettered = "dead_lettered"
+	JobStatusDuplicate    = "duplicate"
+)
+
+var (
+	jobsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "og_describer_semgrep_jobs_total",
+		Help: "Describe jobs processed by queue, resource type and how their message was settled",
+	}, []string{"queue", "resource_type", "status"})
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "og_describer_semgrep_job_duration_seconds",
+		Help:    "Duration of the describe jobs by queue, resource type and how their message was settled",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 900, 1500},
+	}, []string{"queue", "resource_type", "status"})
+	jobsRunning = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "og_describer_semgrep_jobs_running",
+		Help: "Describe jobs currently running by queue",
+	}, []string{"queue"})
+)
@@ -4,17 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/opengovern/og-describer-semgrep/discovery/pkg/orchestrator"
+	"github.com/opengovern/og-describer-semgrep/discovery/provider"
 	"github.com/opengovern/og-describer-semgrep/global"
 	"os"
-	"runtime"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 
 	"github.com/opengovern/og-util/pkg/describe"
 	esSinkClient "github.com/opengovern/og-util/pkg/es/ingest/client"
-	"github.com/opengovern/og-util/pkg/jq"
 	"github.com/opengovern/og-util/pkg/opengovernance-es-sdk"
 	"go.uber.org/zap"
 )
@@ -22,104 +25,430 @@ import (
 type Worker struct {
 	logger   *zap.Logger
 	esClient opengovernance.Client
-	jq       *jq.JobQueue
 
 	esSinkClient esSinkClient.EsSinkServiceClient
+
+	config WorkerConfig
+	queues []jobQueue
+	slots  *jobSlots
+	jobs   sync.WaitGroup
+
+	// stopping is done once the worker stopped taking new jobs
+	stopping context.Context
+	// lock guards consuming, a job is only added to jobs while consuming so none is added once the shutdown
+	// waits for them
+	lock      sync.Mutex
+	consuming bool
+
+	deadLetters *DeadLetterQueue
+	workerID    string
+
+	// conn the jobs are consumed, leased and checkpointed over
+	conn        *nats.Conn
+	js          jetstream.JetStream
+	leases      *JobLeases
+	checkpoints *KVCheckpointStore
+	states      *ObjectResourceStateStore
 }
 
-var (
-	ManualTriggers = os.Getenv("MANUAL_TRIGGERS")
+const (
+	// MaxJobAttempts bounds the attempts of a job, the redeliveries of the message plus the retries the
+	// platform already made (DescribeJob.RetryCounter)
+	MaxJobAttempts = 5
+
+	NakMinDelay = 30 * time.Second
+	NakMaxDelay = 10 * time.Minute
+
+	JobQueueManual    = "manual"
+	JobQueueScheduled = "scheduled"
+
+	// ShutdownSettleTimeout how long the jobs cancelled at the end of the grace period get to settle their messages
+	ShutdownSettleTimeout = 30 * time.Second
 )
 
+// jobQueue a subject the worker consumes jobs from with its own durable consumer
+type jobQueue struct {
+	name        string
+	topic       string
+	consumer    string
+	concurrency int
+}
+
+// jobQueues the queues in priority order, the manually triggered jobs go first
+func jobQueues(config JobsConfig) []jobQueue {
+	return []jobQueue{
+		{
+			name:        JobQueueManual,
+			topic:       global.JobQueueTopicManuals,
+			consumer:    global.ConsumerGroupManuals,
+			concurrency: config.ManualConcurrency,
+		},
+		{
+			name:        JobQueueScheduled,
+			topic:       global.JobQueueTopic,
+			consumer:    global.ConsumerGroup,
+			concurrency: config.ScheduledConcurrency,
+		},
+	}
+}
+
+// NewWorker config is expected to be validated, see LoadWorkerConfig
 func NewWorker(
 
 	logger *zap.Logger,
 	ctx context.Context,
-) (*Worker, error) {
-	url := os.Getenv("NATS_URL")
-	jq, err := jq.New(url, logger)
+	config WorkerConfig,
+) (_ *Worker, err error) {
+	// what is opened so far, closed in reverse order when the worker can not be set up
+	var closers []func()
+	defer func() {
+		if err != nil {
+			for i := len(closers) - 1; i >= 0; i-- {
+				closers[i]()
+			}
+		}
+	}()
+
+	url := config.NATS.URL
+	conn, err := nats.Connect(url)
+	if err != nil {
+		logger.Error("failed to connect to NATS", zap.Error(err), zap.String("url", config.Redacted().NATS.URL))
+		return nil, err
+	}
+	closers = append(closers, conn.Close)
+	js, err := jetstream.New(conn)
 	if err != nil {
-		logger.Error("failed to create job queue", zap.Error(err), zap.String("url", url))
 		return nil, err
 	}
 
-	topic := global.JobQueueTopic
-	if ManualTriggers == "true" {
-		topic = global.JobQueueTopicManuals
+	queues := jobQueues(config.Jobs)
+	topics := []string{global.DeadLetterTopic}
+	for _, queue := range queues {
+		topics = append(topics, queue.topic)
 	}
-	if err := jq.Stream(ctx, global.StreamName, " describe job runner queue", []string{topic}, 200000); err != nil {
+	if _, err := js.CreateOrUpdateStream(ctx, jobStreamConfig(topics)); err != nil {
 		logger.Error("failed to create stream", zap.Error(err))
 		return nil, err
 	}
 
+	deadLetters, err := NewDeadLetterQueue(url)
+	if err != nil {
+		logger.Error("failed to connect the dead-letter queue", zap.Error(err), zap.String("url", config.Redacted().NATS.URL))
+		return nil, err
+	}
+	closers = append(closers, deadLetters.Close)
+	workerID, err := os.Hostname()
+	if err != nil {
+		workerID = "unknown"
+	}
+
+	leases, err := NewJobLeases(ctx, logger, js, config.Jobs.LeaseTTL, workerID)
+	if err != nil {
+		logger.Error("failed to set up the job leases", zap.Error(err))
+		return nil, err
+	}
+	checkpoints, err := NewKVCheckpointStore(ctx, js, config.Jobs.CheckpointTTL)
+	if err != nil {
+		logger.Error("failed to set up the describe checkpoints", zap.Error(err))
+		return nil, err
+	}
+	states, err := NewObjectResourceStateStore(ctx, js)
+	if err != nil {
+		logger.Error("failed to set up the resource states", zap.Error(err))
+		return nil, err
+	}
+
+	memoryLimit := jobMemoryLimit(config.Jobs.MemoryLimitMiB)
+	logger.Info("job slots", zap.Int("concurrency", config.Jobs.Concurrency), zap.Uint64("memoryLimit", memoryLimit))
+
 	w := &Worker{
-		logger: logger,
-		jq:     jq,
+		logger:      logger,
+		config:      config,
+		queues:      queues,
+		slots:       newJobSlots(logger, config.Jobs.Concurrency, memoryLimit, queues),
+		deadLetters: deadLetters,
+		workerID:    workerID,
+		conn:        conn,
+		js:          js,
+		leases:      leases,
+		checkpoints: checkpoints,
+		states:      states,
 	}
 
 	return w, nil
 }
 
+// jobStreamConfig the work queue stream of the describe jobs
+func jobStreamConfig(topics []string) jetstream.StreamConfig {
+	const maxMsgs = 200000
+	return jetstream.StreamConfig{
+		Name:         global.StreamName,
+		Description:  " describe job runner queue",
+		Subjects:     topics,
+		Retention:    jetstream.WorkQueuePolicy,
+		MaxConsumers: -1,
+		MaxMsgs:      maxMsgs,
+		MaxBytes:     1000 * maxMsgs,
+		Discard:      jetstream.DiscardNew,
+		Duplicates:   15 * time.Minute,
+		Replicas:     1,
+		Storage:      jetstream.MemoryStorage,
+	}
+}
+
+// Run consumes the jobs of every queue until ctx is done, it then stops pulling messages and gives the jobs in
+// flight the grace period to finish, the jobs still running after that are cancelled and their messages
+// delivered again
 func (w *Worker) Run(ctx context.Context) error {
 	w.logger.Info("starting to consume")
-	topic := global.JobQueueTopic
-	consumer := global.ConsumerGroup
-	if ManualTriggers == "true" {
-		topic = global.JobQueueTopicManuals
-		consumer = global.ConsumerGroupManuals
+
+	// the jobs outlive ctx so a shutdown does not interrupt them
+	w.stopping = ctx
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	var consumeCtxs []jetstream.ConsumeContext
+	for _, queue := range w.queues {
+		consumeCtx, err := w.consume(ctx, jobCtx, queue)
+		if err != nil {
+			for _, c := range consumeCtxs {
+				c.Stop()
+			}
+			return err
+		}
+		consumeCtxs = append(consumeCtxs, consumeCtx)
+	}
+
+	w.logger.Info("consuming")
+	w.setConsuming(true)
+
+	<-ctx.Done()
+	// the messages the consumers still deliver while draining are released instead of started
+	w.setConsuming(false)
+	w.logger.Info("shutting down, waiting for the jobs in flight", zap.Duration("gracePeriod", w.config.Jobs.ShutdownGracePeriod))
+	// the messages already pulled are handed back rather than left until AckWait elapses
+	for _, consumeCtx := range consumeCtxs {
+		consumeCtx.Drain()
 	}
-	consumeCtx, err := w.jq.ConsumeWithConfig(ctx, consumer, global.StreamName, []string{topic}, jetstream.ConsumerConfig{
+
+	done := make(chan struct{})
+	go func() {
+		w.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		w.logger.Info("jobs in flight finished")
+	case <-time.After(w.config.Jobs.ShutdownGracePeriod):
+		w.logger.Warn("grace period elapsed, cancelling the jobs in flight")
+		cancelJobs()
+		select {
+		case <-done:
+		case <-time.After(ShutdownSettleTimeout):
+			w.logger.Error("jobs did not settle in time, their messages are delivered again once AckWait elapses")
+		}
+	}
+	w.deadLetters.Close()
+	w.conn.Close()
+
+	return nil
+}
+
+// consume runs the jobs of queue on jobCtx until ctx is done
+func (w *Worker) consume(ctx, jobCtx context.Context, queue jobQueue) (jetstream.ConsumeContext, error) {
+	logger := w.logger.With(zap.String("queue", queue.name))
+	consumer, err := w.js.CreateOrUpdateConsumer(ctx, global.StreamName, jetstream.ConsumerConfig{
+		Name:              fmt.Sprintf("%s-service", queue.consumer),
+		Description:       fmt.Sprintf("%s Service", strings.ToTitle(queue.consumer)),
+		FilterSubjects:    []string{queue.topic},
 		Replicas:          1,
 		AckPolicy:         jetstream.AckExplicitPolicy,
 		DeliverPolicy:     jetstream.DeliverAllPolicy,
 		MaxAckPending:     -1,
-		AckWait:           time.Minute * 30,
+		AckWait:           w.config.Jobs.AckWait,
+		MaxDeliver:        MaxJobAttempts,
 		InactiveThreshold: time.Hour,
-	}, []jetstream.PullConsumeOpt{
-		jetstream.PullMaxMessages(1),
-	}, func(msg jetstream.Msg) {
-		w.logger.Info("received a new job")
-
-		defer msg.Ack()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return consumer.Consume(func(msg jetstream.Msg) {
+		logger.Info("received a new job")
+		if ctx.Err() != nil {
+			// buffered before the shutdown
+			w.release(msg)
+			return
+		}
 
-		ctx, cancel := context.WithTimeoutCause(ctx, time.Minute*25, errors.New("describe worker timed out"))
-		defer cancel()
+		job, err := w.claim(jobCtx, msg)
+		if err != nil {
+			// malformed or a duplicate delivery, settled without taking a slot
+			w.finish(logger, queue, msg, err, time.Now())
+			return
+		}
 
-		if err := w.ProcessMessage(ctx, msg); err != nil {
-			w.logger.Error("failed to process message", zap.Error(err))
+		if unlock, ok := w.slots.tryLockIntegration(job.input.DescribeJob.IntegrationID); ok {
+			job.unlock = unlock
+			w.start(ctx, logger, queue, msg, job)
+			return
 		}
-		err := msg.Ack()
-		if err != nil {
-			w.logger.Error("failed to ack message", zap.Error(err))
+		if !w.slots.park() {
+			// as many jobs as there are slots wait for their integration already, this one waits in the queue
+			w.waitIntegration(ctx, logger, queue, msg, job, false)
+			return
 		}
+		// another job of the integration runs, this one waits aside so the jobs behind it in the queue start
+		if !w.addJob() {
+			w.slots.unpark()
+			job.done()
+			w.release(msg)
+			return
+		}
+		go func() {
+			defer w.jobs.Done()
+			w.waitIntegration(ctx, logger, queue, msg, job, true)
+		}()
+	}, jetstream.PullMaxMessages(w.slots.limit(queue.name)))
+}
+
+// claimedJob a job taken off its queue, it holds the lease of the job while it waits and runs
+type claimedJob struct {
+	input describe.DescribeWorkerInput
+	ctx   context.Context
+	// lease nil when it could not be acquired, the job then runs without it
+	lease  *JobLease
+	cancel context.CancelCauseFunc
+	// unlock releases the integration once it is locked
+	unlock func()
+}
+
+// done releases the integration and the lease of the job
+func (j *claimedJob) done() {
+	if j.unlock != nil {
+		j.unlock()
+	}
+	if j.lease != nil {
+		j.lease.Release()
+	}
+	j.cancel(nil)
+}
+
+// claim parses the job and takes its lease, a delivery of the job running elsewhere (e.g. redelivered after
+// AckWait) is a DuplicateJobError so it is not run twice
+func (w *Worker) claim(ctx context.Context, msg jetstream.Msg) (*claimedJob, error) {
+	var input describe.DescribeWorkerInput
+	if err := json.Unmarshal(msg.Data(), &input); err != nil {
+		return nil, PermanentError{fmt.Errorf("malformed describe worker input: %w", err)}
+	}
 
-		w.logger.Info("processing a job completed")
+	ctx, cancelLeased := context.WithCancelCause(ctx)
+	job := &claimedJob{input: input, ctx: ctx, cancel: cancelLeased}
+	lease, err := w.leases.Acquire(ctx, input.DescribeJob.JobID, func(err error) {
+		w.logger.Error("lost the job lease, cancelling the job", zap.Uint("id", input.DescribeJob.JobID), zap.Error(err))
+		cancelLeased(err)
 	})
+	switch {
+	case errors.Is(err, ErrJobLeased):
+		cancelLeased(nil)
+		w.logger.Info("skipping a duplicate delivery of a running job", zap.Uint("id", input.DescribeJob.JobID))
+		return nil, DuplicateJobError{fmt.Errorf("job %d: %w", input.DescribeJob.JobID, err)}
+	case err != nil:
+		// the lease only guards against duplicates, the job still runs without it
+		w.logger.Warn("failed to acquire the job lease", zap.Uint("id", input.DescribeJob.JobID), zap.Error(err))
+	default:
+		job.lease = lease
+	}
+	return job, nil
+}
+
+// waitIntegration waits for the other job of the integration to finish then starts the job, a job still waiting
+// on shutdown is left to another worker. A parked job gives its place back once the wait is over
+func (w *Worker) waitIntegration(ctx context.Context, logger *zap.Logger, queue jobQueue, msg jetstream.Msg, job *claimedJob, parked bool) {
+	unlock, err := w.slots.lockIntegration(ctx, job.input.DescribeJob.IntegrationID, w.inProgress(msg))
+	if parked {
+		w.slots.unpark()
+	}
 	if err != nil {
-		return err
+		logger.Info("stopped waiting for the integration", zap.Error(err))
+		job.done()
+		w.release(msg)
+		return
 	}
+	job.unlock = unlock
+	w.start(ctx, logger, queue, msg, job)
+}
 
-	w.logger.Info("consuming")
+// start waits for a slot of the queue then runs the job in the background
+func (w *Worker) start(ctx context.Context, logger *zap.Logger, queue jobQueue, msg jetstream.Msg, job *claimedJob) {
+	// blocking here keeps the consumer from pulling more jobs than there are free slots, each consumer
+	// has its own handler goroutine so a blocked queue does not hold the others back
+	if err := w.slots.acquire(ctx, queue.name, w.inProgress(msg)); err != nil {
+		logger.Info("stopped waiting for a job slot", zap.Error(err))
+		job.done()
+		w.release(msg)
+		return
+	}
+	if ctx.Err() != nil || !w.addJob() {
+		w.slots.release(queue.name)
+		job.done()
+		w.release(msg)
+		return
+	}
 
-	<-ctx.Done()
-	consumeCtx.Drain()
-	consumeCtx.Stop()
+	jobsRunning.WithLabelValues(queue.name).Inc()
+	go func() {
+		defer w.jobs.Done()
+		defer w.slots.release(queue.name)
+		defer jobsRunning.WithLabelValues(queue.name).Dec()
 
-	return nil
+		startTime := time.Now()
+		err := w.processJob(job, msg)
+		job.done()
+		w.finish(logger, queue, msg, err, startTime)
+	}()
 }
 
-func (w *Worker) ProcessMessage(ctx context.Context, msg jetstream.Msg) error {
-	startTime := time.Now()
-	var input describe.DescribeWorkerInput
-	err := json.Unmarshal(msg.Data(), &input)
+// finish settles the message of a job and records its outcome
+func (w *Worker) finish(logger *zap.Logger, queue jobQueue, msg jetstream.Msg, err error, startTime time.Time) {
 	if err != nil {
-		return err
+		logger.Error("failed to process message", zap.Error(err))
+	}
+	status := w.settle(msg, err)
+
+	resourceType := messageResourceType(msg)
+	jobsProcessed.WithLabelValues(queue.name, resourceType, status).Inc()
+	jobDuration.WithLabelValues(queue.name, resourceType, status).Observe(time.Since(startTime).Seconds())
+
+	logger.Info("processing a job completed")
+}
+
+// processJob runs a claimed job whose integration is locked
+func (w *Worker) processJob(job *claimedJob, msg jetstream.Msg) error {
+	startTime := time.Now()
+	input := job.input
+
+	ctx, cancel := context.WithTimeoutCause(job.ctx, w.config.Jobs.Timeout, errors.New("describe worker timed out"))
+	defer cancel()
+	ctx = provider.WithAPILimits(ctx, w.config.SemgrepAPI)
+	ctx = orchestrator.WithIngestConfig(ctx, w.config.Ingest)
+	ctx = orchestrator.WithGrpcTLSConfig(ctx, w.config.GRPCTLS)
+	ctx = provider.WithCheckpointStore(ctx, w.checkpoints)
+	ctx = orchestrator.WithResourceStateStore(ctx, w.states)
+	if w.config.Auth.JWTPrivateKey != "" {
+		ctx = orchestrator.WithJWTPrivateKey(ctx, w.config.Auth.JWTPrivateKey)
+	}
+	if w.config.Vault.AllowLocal {
+		ctx = orchestrator.WithLocalVault(ctx)
+	}
+	ctx = orchestrator.WithHeartbeat(ctx, w.inProgress(msg))
+	if canRedeliver(msg, input.DescribeJob.RetryCounter) {
+		ctx = orchestrator.WithRequeue(ctx)
 	}
-	runtime.GC()
 
 	w.logger.Info("running job", zap.Uint("id", input.DescribeJob.JobID), zap.String("type", input.DescribeJob.ResourceType), zap.String("providerID", input.DescribeJob.ProviderID))
 
-	err = orchestrator.DescribeHandler(ctx, w.logger, orchestrator.TriggeredByLocal, input)
+	err := orchestrator.DescribeHandler(ctx, w.logger, orchestrator.TriggeredByLocal, input)
 	endTime := time.Now()
 
 	w.logger.Info("job completed", zap.Uint("id", input.DescribeJob.JobID), zap.String("type", input.DescribeJob.ResourceType), zap.String("providerID", input.DescribeJob.ProviderID), zap.Duration("duration", endTime.Sub(startTime)))
@@ -130,3 +459,170 @@ func (w *Worker) ProcessMessage(ctx context.Context, msg jetstream.Msg) error {
 
 	return nil
 }
+
+// Ready reports why the worker can not take jobs, nil when the connections the jobs use are up and it is consuming
+func (w *Worker) Ready() error {
+	if !w.conn.IsConnected() {
+		return errors.New("not connected to NATS")
+	}
+	if !w.deadLetters.Connected() {
+		return errors.New("dead-letter queue is not connected to NATS")
+	}
+	w.lock.Lock()
+	consuming := w.consuming
+	w.lock.Unlock()
+	if !consuming {
+		return errors.New("consumer is not active")
+	}
+	return nil
+}
+
+func (w *Worker) setConsuming(consuming bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.consuming = consuming
+}
+
+// addJob adds a job to the ones the shutdown waits for, false once the shutdown started
+func (w *Worker) addJob() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.consuming {
+		return false
+	}
+	w.jobs.Add(1)
+	return true
+}
+
+// inProgress keeps the message from being redelivered while its job waits or runs
+func (w *Worker) inProgress(msg jetstream.Msg) func() {
+	return func() {
+		if err := msg.InProgress(); err != nil {
+			w.logger.Warn("failed to mark message in progress", zap.Error(err))
+		}
+	}
+}
+
+// release hands a message that was not worked on back to the stream right away
+func (w *Worker) release(msg jetstream.Msg) {
+	if err := msg.Nak(); err != nil {
+		w.logger.Error("failed to release message", zap.Error(err))
+	}
+}
+
+// shuttingDown whether the worker stopped taking new jobs
+func (w *Worker) shuttingDown() bool {
+	return w.stopping != nil && w.stopping.Err() != nil
+}
+
+// PermanentError a message that can never be processed, e.g. because it can not be parsed
+type PermanentError struct {
+	error
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.error
+}
+
+// settle acks processed jobs, redelivers the retryable failures later and terminates the messages that will
+// never succeed, the terminated ones and the ones out of attempts are parked on the dead-letter subject.
+// It returns the job status reported in the metrics
+func (w *Worker) settle(msg jetstream.Msg, err error) string {
+	var input describe.DescribeWorkerInput
+	_ = json.Unmarshal(msg.Data(), &input)
+	retryCounter := input.DescribeJob.RetryCounter
+
+	var jobFailedErr orchestrator.JobFailedError
+	var requeueErr orchestrator.RequeueError
+	var permanentErr PermanentError
+	var duplicateErr DuplicateJobError
+	var status string
+	switch {
+	case err == nil:
+		status = JobStatusSucceeded
+		err = msg.Ack()
+	case errors.As(err, &duplicateErr):
+		// the delivery holding the lease settles the job
+		status = JobStatusDuplicate
+		err = msg.Ack()
+	case errors.As(err, &jobFailedErr):
+		// the failure was reported, the platform decides whether to retry
+		status = JobStatusFailed
+		if orchestrator.IsRetryable(jobFailedErr.Unwrap()) && !canRedeliver(msg, retryCounter) {
+			w.deadLetter(msg, DeadLetterReasonExhausted, jobFailedErr.Unwrap(), retryCounter)
+			status = JobStatusDeadLettered
+		}
+		err = msg.Ack()
+	case errors.As(err, &requeueErr) || (!errors.As(err, &permanentErr) && orchestrator.IsRetryable(err)):
+		if !canRedeliver(msg, retryCounter) {
+			w.deadLetter(msg, DeadLetterReasonExhausted, err, retryCounter)
+			status = JobStatusDeadLettered
+			err = msg.Term()
+			break
+		}
+		status = JobStatusRequeued
+		if w.shuttingDown() {
+			// interrupted by the shutdown, another worker can pick it up right away
+			w.logger.Info("job released on shutdown")
+			err = msg.Nak()
+			break
+		}
+		delay := nakDelay(msg)
+		w.logger.Info("job will be delivered again", zap.Duration("delay", delay))
+		err = msg.NakWithDelay(delay)
+	case errors.As(err, &permanentErr):
+		w.deadLetter(msg, DeadLetterReasonMalformed, err, retryCounter)
+		status = JobStatusDeadLettered
+		err = msg.Term()
+	default:
+		// a handler that can not even be set up, retrying would fail the same way
+		w.deadLetter(msg, DeadLetterReasonPermanent, err, retryCounter)
+		status = JobStatusDeadLettered
+		err = msg.Term()
+	}
+	if err != nil {
+		w.logger.Error("failed to settle message", zap.Error(err))
+	}
+	return status
+}
+
+// messageResourceType the resource type of the job, unknown when the message can not be parsed
+func messageResourceType(msg jetstream.Msg) string {
+	var input describe.DescribeWorkerInput
+	if err := json.Unmarshal(msg.Data(), &input); err != nil || input.DescribeJob.ResourceType == "" {
+		return "unknown"
+	}
+	return input.DescribeJob.ResourceType
+}
+
+func (w *Worker) deadLetter(msg jetstream.Msg, reason string, cause error, retryCounter uint) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w.logger.Warn("dead-lettering job", zap.String("reason", reason), zap.Error(cause))
+	if err := w.deadLetters.Publish(ctx, msg, reason, cause, retryCounter, w.workerID); err != nil {
+		w.logger.Error("failed to dead-letter job", zap.Error(err))
+	}
+}
+
+// canRedeliver whether the job has attempts left, counting the retries the platform already made
+func canRedeliver(msg jetstream.Msg, retryCounter uint) bool {
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return false
+	}
+	return metadata.NumDelivered+uint64(retryCounter) < MaxJobAttempts
+}
+
+// nakDelay backs off exponentially with the number of deliveries
+func nakDelay(msg jetstream.Msg) time.Duration {
+	delay := NakMinDelay
+	if metadata, err := msg.Metadata(); err == nil {
+		for i := uint64(1); i < metadata.NumDelivered && delay < NakMaxDelay; i++ {
+			delay *= 2
+		}
+	}
+	return min(delay, NakMaxDelay)
+}
@@ -0,0 +1,34 @@
+package pkg
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestWorkerAddJobRefusedOnceShuttingDown(t *testing.T) {
+	w := &Worker{}
+	if w.addJob() {
+		t.Fatal("a job was added before consuming")
+	}
+
+	w.setConsuming(true)
+	var added sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		added.Add(1)
+		go func() {
+			defer added.Done()
+			// what a consumer callback does while the shutdown starts
+			if w.addJob() {
+				w.jobs.Done()
+			}
+		}()
+	}
+
+	w.setConsuming(false)
+	// no job may be added once the shutdown waits for them
+	w.jobs.Wait()
+	if w.addJob() {
+		t.Fatal("a job was added after the shutdown started")
+	}
+	added.Wait()
+}
@@ -0,0 +1,125 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials/oauth"
+	"os"
+)
+
+var (
+	grpcTLSConfigKey string = "grpcTLSConfig"
+)
+
+// GrpcTLSConfig how the connections to the DescribeService and the EsSinkService are secured
+type GrpcTLSConfig struct {
+	// CACertFile PEM bundle trusted on top of the system roots
+	CACertFile string `yaml:"caCertFile"`
+	// ServerName overrides the name the server certificate is verified against
+	ServerName string `yaml:"serverName"`
+	// ClientCertFile and ClientKeyFile enable mTLS
+	ClientCertFile string `yaml:"clientCertFile"`
+	ClientKeyFile  string `yaml:"clientKeyFile"`
+	// InsecureSkipVerify disables the server certificate verification, it must be explicitly opted in
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+}
+
+func WithGrpcTLSConfig(ctx context.Context, config GrpcTLSConfig) context.Context {
+	return context.WithValue(ctx, grpcTLSConfigKey, config)
+}
+
+// GetGrpcTLSConfigFromContext returns the zero config, TLS only for authenticated endpoints, when the context
+// does not carry one
+func GetGrpcTLSConfigFromContext(ctx context.Context) GrpcTLSConfig {
+	config, _ := ctx.Value(grpcTLSConfigKey).(GrpcTLSConfig)
+	return config
+}
+
+// Validate checks the files exist and the client certificate comes with its key
+func (c GrpcTLSConfig) Validate() error {
+	var errs []error
+	for _, file := range []string{c.CACertFile, c.ClientCertFile, c.ClientKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("invalid grpc tls file: %w", err))
+		}
+	}
+	if (c.ClientCertFile == "") != (c.ClientKeyFile == "") {
+		errs = append(errs, errors.New("grpc tls client cert and key files must be given together"))
+	}
+	return errors.Join(errs...)
+}
+
+// enabled any setting asks for TLS even when the endpoint is not authenticated
+func (c GrpcTLSConfig) enabled() bool {
+	return c.CACertFile != "" || c.ServerName != "" || c.ClientCertFile != "" || c.InsecureSkipVerify
+}
+
+func (c GrpcTLSConfig) TLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CACertFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		caCert, err := os.ReadFile(c.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %s", c.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCertFile != "" || c.ClientKeyFile != "" {
+		if c.ClientCertFile == "" || c.ClientKeyFile == "" {
+			return nil, fmt.Errorf("both the client certificate and key are required for mTLS")
+		}
+		cert, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// DialOptions transport and per RPC credentials for the platform connections, TLS is used whenever
+// a token is sent or a TLS setting is given, plain text otherwise
+func (c GrpcTLSConfig) DialOptions(token string) ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	if token == "" && !c.enabled() {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		return opts, nil
+	}
+
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(oauth.TokenSource{
+			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{
+				AccessToken: token,
+			}),
+		}))
+	}
+	return opts, nil
+}
@@ -2,7 +2,6 @@ package orchestrator
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,14 +9,11 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/opengovern/og-describer-semgrep/discovery/provider"
 	describepkg "github.com/opengovern/og-util/pkg/describe"
 	"github.com/opengovern/og-util/pkg/vault"
 	"github.com/opengovern/og-util/proto/src/golang"
-	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/credentials/oauth"
 	"google.golang.org/grpc/metadata"
 
 	"go.uber.org/zap"
@@ -26,10 +22,26 @@ import (
 const (
 	DescribeResourceJobFailed    string = "FAILED"
 	DescribeResourceJobSucceeded string = "SUCCEEDED"
+
+	DeliverResultTimeout    = 10 * time.Minute
+	DeliverResultMinBackoff = time.Second
+	DeliverResultMaxBackoff = time.Minute
+)
+
+var (
+	jwtPrivateKeyKey string = "jwtPrivateKey"
 )
 
-func getJWTAuthToken() (string, error) {
-	privateKey, ok := os.LookupEnv("JWT_PRIVATE_KEY")
+// WithJWTPrivateKey sets the key signing the tokens sent to the platform, JWT_PRIVATE_KEY is used otherwise
+func WithJWTPrivateKey(ctx context.Context, privateKey string) context.Context {
+	return context.WithValue(ctx, jwtPrivateKeyKey, privateKey)
+}
+
+func getJWTAuthToken(ctx context.Context) (string, error) {
+	privateKey, ok := ctx.Value(jwtPrivateKeyKey).(string)
+	if !ok || privateKey == "" {
+		privateKey, ok = os.LookupEnv("JWT_PRIVATE_KEY")
+	}
 	if !ok {
 		return "", fmt.Errorf("JWT_PRIVATE_KEY not set")
 	}
@@ -63,41 +75,32 @@ const (
 
 // DescribeHandler
 // TriggeredBy is not used for now but might be relevant in the future
-func DescribeHandler(ctx context.Context, logger *zap.Logger, _ TriggeredBy, input describepkg.DescribeWorkerInput) error {
-	var err error
+func DescribeHandler(ctx context.Context, logger *zap.Logger, _ TriggeredBy, input describepkg.DescribeWorkerInput) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("There is a Panic: %v", r)
+			err = panicError(r)
+			logger.Error("paniced while handling the describe job", zap.Error(err))
 		}
 		logger.Sync()
 	}()
 
 	var token string
 	if input.EndpointAuth {
-		token, err = getJWTAuthToken()
+		token, err = getJWTAuthToken(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to get JWT token: %w", err)
 		}
 	}
 
-	var client golang.DescribeServiceClient
-	grpcCtx := metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{}))
-
 	logger.Info("Setting grpc connection opts")
-	var opts []grpc.DialOption
-	if input.EndpointAuth {
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})))
-		opts = append(opts, grpc.WithPerRPCCredentials(oauth.TokenSource{
-			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{
-				AccessToken: token,
-			}),
-		}))
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	opts, err := GetGrpcTLSConfigFromContext(ctx).DialOptions(token)
+	if err != nil {
+		return fmt.Errorf("failed to set up grpc TLS: %w", err)
 	}
 	logger.Info("Connecting to grpc server")
+	var conn *grpc.ClientConn
 	for retry := 0; retry < 5; retry++ {
-		conn, err := grpc.NewClient(
+		conn, err = grpc.NewClient(
 			input.JobEndpoint,
 			opts...,
 		)
@@ -109,9 +112,74 @@ func DescribeHandler(ctx context.Context, logger *zap.Logger, _ TriggeredBy, inp
 			time.Sleep(1 * time.Second)
 			continue
 		}
-		client = golang.NewDescribeServiceClient(conn)
 		break
 	}
+	defer conn.Close()
+	client := golang.NewDescribeServiceClient(conn)
+	grpcCtx := metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{}))
+
+	resourceIds, err := runDescribeJob(ctx, grpcCtx, logger, client, input, token)
+	logger.Info("Resource IDs fetched", zap.Any("resourceIds", resourceIds))
+	if err != nil && requeueAllowed(ctx) && IsRetryable(err) {
+		logger.Warn("job failed with a retryable error, it is left to the queue", zap.Error(err))
+		return RequeueError{err}
+	}
+
+	jobErr := err
+	errMsg := ""
+	errCode := ""
+	status := DescribeResourceJobSucceeded
+	if err != nil {
+		errMsg = err.Error()
+		var kerr Error
+		if errors.As(err, &kerr) {
+			errCode = kerr.ErrCode
+		}
+		status = DescribeResourceJobFailed
+	}
+
+	logger.Info("Delivering result")
+	// the job context may be the reason the job failed, the result must be delivered anyway
+	deliverCtx, cancel := context.WithTimeout(context.WithoutCancel(grpcCtx), DeliverResultTimeout)
+	defer cancel()
+	err = deliverResult(deliverCtx, logger, client, &golang.DeliverResultRequest{
+		JobId:     uint32(input.DescribeJob.JobID),
+		Status:    status,
+		Error:     errMsg,
+		ErrorCode: errCode,
+		DescribeJob: &golang.DescribeJob{
+			JobId:           uint32(input.DescribeJob.JobID),
+			ResourceType:    input.DescribeJob.ResourceType,
+			IntegrationId:   input.DescribeJob.IntegrationID,
+			ProviderId:      input.DescribeJob.ProviderID,
+			DescribedAt:     input.DescribeJob.DescribedAt,
+			IntegrationType: string(input.DescribeJob.IntegrationType),
+			ConfigReg:       input.DescribeJob.CipherText,
+			TriggerType:     string(input.DescribeJob.TriggerType),
+			RetryCounter:    uint32(input.DescribeJob.RetryCounter),
+		},
+		DescribedResourceIds: resourceIds,
+	})
+	if err != nil {
+		return RequeueError{fmt.Errorf("failed to deliver result: %w", err)}
+	}
+
+	logger.Info("job done", zap.Uint("jobID", input.DescribeJob.JobID))
+	if jobErr != nil {
+		return JobFailedError{jobErr}
+	}
+	return nil
+}
+
+// runDescribeJob runs the job once the describe service is reachable, every failure including a panic
+// ends up in the returned error so it is delivered as the job result
+func runDescribeJob(ctx, grpcCtx context.Context, logger *zap.Logger, client golang.DescribeServiceClient, input describepkg.DescribeWorkerInput, token string) (resourceIds []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+			logger.Error("paniced with error", zap.Error(err))
+		}
+	}()
 
 	logger.Info("Setting job in progress")
 	for retry := 0; retry < 5; retry++ {
@@ -121,7 +189,7 @@ func DescribeHandler(ctx context.Context, logger *zap.Logger, _ TriggeredBy, inp
 		if err != nil {
 			logger.Error("[result delivery] set in progress failure:", zap.Error(err))
 			if retry == 4 {
-				return err
+				return nil, err
 			}
 			time.Sleep(1 * time.Second)
 			continue
@@ -134,18 +202,30 @@ func DescribeHandler(ctx context.Context, logger *zap.Logger, _ TriggeredBy, inp
 	case vault.AwsKMS:
 		vaultSc, err = vault.NewKMSVaultSourceConfig(ctx, input.VaultConfig.Aws, input.VaultConfig.KeyId)
 		if err != nil {
-			return fmt.Errorf("failed to initialize KMS vault: %w", err)
+			return nil, fmt.Errorf("failed to initialize KMS vault: %w", err)
 		}
 	case vault.AzureKeyVault:
 		vaultSc, err = vault.NewAzureVaultClient(ctx, logger, input.VaultConfig.Azure, input.VaultConfig.KeyId)
 		if err != nil {
-			return fmt.Errorf("failed to initialize Azure vault: %w", err)
+			return nil, fmt.Errorf("failed to initialize Azure vault: %w", err)
 		}
 	case vault.HashiCorpVault:
 		vaultSc, err = vault.NewHashiCorpVaultClient(ctx, logger, input.VaultConfig.HashiCorp, input.VaultConfig.KeyId)
 		if err != nil {
-			return fmt.Errorf("failed to initialize HashiCorp vault: %w", err)
+			return nil, fmt.Errorf("failed to initialize HashiCorp vault: %w", err)
 		}
+	case LocalVault:
+		if !localVaultAllowed(ctx) {
+			return nil, fmt.Errorf("local vault is disabled on this worker, set ALLOW_LOCAL_VAULT to use it")
+		}
+		logger.Warn("using the local vault, credentials are not read from a secure store")
+		vaultSc, err = NewLocalVaultSourceConfig(input.VaultConfig.KeyId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize local vault: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported vault provider %q, expected one of %s, %s, %s or %s", input.VaultConfig.Provider,
+			vault.AwsKMS, vault.AzureKeyVault, vault.HashiCorpVault, LocalVault)
 	}
 	logger.Info("Vault setup complete")
 
@@ -153,7 +233,13 @@ func DescribeHandler(ctx context.Context, logger *zap.Logger, _ TriggeredBy, inp
 		ctx = context.WithValue(ctx, k, v)
 	}
 
-	resourceIds, err := Do(
+	progress := &provider.Progress{}
+	ctx = provider.WithProgress(ctx, progress)
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+	go runHeartbeat(heartbeatCtx, grpcCtx, logger, client, input.DescribeJob, progress)
+
+	return Do(
 		ctx,
 		vaultSc,
 		logger,
@@ -164,48 +250,23 @@ func DescribeHandler(ctx context.Context, logger *zap.Logger, _ TriggeredBy, inp
 		input.IngestionPipelineEndpoint,
 		input.UseOpenSearch,
 	)
-	logger.Info("Resource IDs fetched", zap.Any("resourceIds", resourceIds))
+}
 
-	errMsg := ""
-	errCode := ""
-	status := DescribeResourceJobSucceeded
-	if err != nil {
-		errMsg = err.Error()
-		var kerr Error
-		if errors.As(err, &kerr) {
-			errCode = kerr.ErrCode
+// deliverResult retries with exponential backoff until the result is delivered or ctx is done
+func deliverResult(ctx context.Context, logger *zap.Logger, client golang.DescribeServiceClient, result *golang.DeliverResultRequest) error {
+	backoff := DeliverResultMinBackoff
+	for {
+		_, err := client.DeliverResult(ctx, result)
+		if err == nil {
+			return nil
 		}
-		status = DescribeResourceJobFailed
-	}
+		logger.Error("[result delivery] rpc failed:", zap.Error(err), zap.Duration("retryIn", backoff))
 
-	logger.Info("Delivering result")
-	for retry := 0; retry < 5; retry++ {
-		_, err = client.DeliverResult(grpcCtx, &golang.DeliverResultRequest{
-			JobId:     uint32(input.DescribeJob.JobID),
-			Status:    status,
-			Error:     errMsg,
-			ErrorCode: errCode,
-			DescribeJob: &golang.DescribeJob{
-				JobId:           uint32(input.DescribeJob.JobID),
-				ResourceType:    input.DescribeJob.ResourceType,
-				IntegrationId:   input.DescribeJob.IntegrationID,
-				ProviderId:      input.DescribeJob.ProviderID,
-				DescribedAt:     input.DescribeJob.DescribedAt,
-				IntegrationType: string(input.DescribeJob.IntegrationType),
-				ConfigReg:       input.DescribeJob.CipherText,
-				TriggerType:     string(input.DescribeJob.TriggerType),
-				RetryCounter:    uint32(input.DescribeJob.RetryCounter),
-			},
-			DescribedResourceIds: resourceIds,
-		})
-		if err != nil {
-			logger.Error("[result delivery] rpc failed:", zap.Error(err))
-			time.Sleep(1 * time.Second)
-			continue
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last error: %v", ctx.Err(), err)
 		}
-		break
+		backoff = min(2*backoff, DeliverResultMaxBackoff)
 	}
-
-	logger.Info("job done", zap.Uint("jobID", input.DescribeJob.JobID))
-	return nil
 }
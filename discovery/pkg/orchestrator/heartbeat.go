@@ -0,0 +1,67 @@
+package orchestrator
+
+import (
+	"context"
+	"github.com/opengovern/og-describer-semgrep/discovery/provider"
+	describepkg "github.com/opengovern/og-util/pkg/describe"
+	"github.com/opengovern/og-util/proto/src/golang"
+	"go.uber.org/zap"
+	"time"
+)
+
+const HeartbeatInterval = time.Minute
+
+var (
+	heartbeatKey string = "heartbeat"
+)
+
+// WithHeartbeat registers a function called on every heartbeat of the job, e.g. to tell the queue the job is alive
+func WithHeartbeat(ctx context.Context, heartbeat func()) context.Context {
+	return context.WithValue(ctx, heartbeatKey, heartbeat)
+}
+
+func getHeartbeatFromContext(ctx context.Context) func() {
+	heartbeat, ok := ctx.Value(heartbeatKey).(func())
+	if !ok {
+		return func() {}
+	}
+	return heartbeat
+}
+
+// runHeartbeat reports the progress of the job every HeartbeatInterval until ctx is done, the describe
+// service only knows about the job being in progress so the details go to the logs
+func runHeartbeat(ctx, grpcCtx context.Context, logger *zap.Logger, client golang.DescribeServiceClient, job describepkg.DescribeJob, progress *provider.Progress) {
+	heartbeat := getHeartbeatFromContext(ctx)
+	startTime := time.Now()
+
+	t := time.NewTicker(HeartbeatInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		snapshot := progress.Snapshot()
+		logger.Info("describe job progress",
+			zap.Uint("jobID", job.JobID),
+			zap.String("resourceType", job.ResourceType),
+			zap.Int64("resources", snapshot.Resources),
+			zap.Int64("apiCalls", snapshot.APICalls),
+			zap.String("deployment", snapshot.Deployment),
+			zap.String("project", snapshot.Project),
+			zap.Duration("elapsed", time.Since(startTime)),
+		)
+
+		heartbeat()
+
+		_, err := client.SetInProgress(grpcCtx, &golang.SetInProgressRequest{
+			JobId: uint32(job.JobID),
+		})
+		if err != nil {
+			logger.Warn("[heartbeat] set in progress failure", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+// NoCompression sends the Ingest batches uncompressed
+const NoCompression = "none"
+
+var (
+	ingestConfigKey string = "ingestConfig"
+)
+
+// IngestConfig how the resources are delivered to the platform
+type IngestConfig struct {
+	// SpoolDir keeps the batches that could not be delivered, one directory per job, so a job run again after a
+	// restart replays them
+	SpoolDir string `yaml:"spoolDir"`
+	// SpoolMaxMiB size of all the spooled batches of the worker, a batch that does not fit is lost
+	SpoolMaxMiB int64 `yaml:"spoolMaxMiB"`
+	// SpoolMaxAge how long the batches of a job that never ran again are kept
+	SpoolMaxAge time.Duration `yaml:"spoolMaxAge"`
+	// Compression compressor of the Ingest calls, NoCompression (or empty) to send them as they are. A sink that
+	// does not support it gets the batches uncompressed
+	Compression string `yaml:"compression"`
+}
+
+var DefaultIngestConfig = IngestConfig{
+	SpoolDir:    filepath.Join(os.TempDir(), "og-describer-semgrep-spool"),
+	SpoolMaxMiB: 512,
+	SpoolMaxAge: 24 * time.Hour,
+	Compression: "gzip",
+}
+
+func WithIngestConfig(ctx context.Context, config IngestConfig) context.Context {
+	return context.WithValue(ctx, ingestConfigKey, config)
+}
+
+// GetIngestConfigFromContext returns DefaultIngestConfig when the context does not carry a config
+func GetIngestConfigFromContext(ctx context.Context) IngestConfig {
+	config, ok := ctx.Value(ingestConfigKey).(IngestConfig)
+	if !ok {
+		return DefaultIngestConfig
+	}
+	return config
+}
+
+// Validate reports every invalid setting at once
+func (c IngestConfig) Validate() error {
+	var errs []error
+	if c.SpoolDir == "" {
+		errs = append(errs, errors.New("ingest spool dir is required"))
+	}
+	if c.SpoolMaxMiB < 1 {
+		errs = append(errs, errors.New("ingest spool max size must be at least 1MiB"))
+	}
+	if c.SpoolMaxAge < time.Minute {
+		errs = append(errs, errors.New("ingest spool max age must be at least 1m"))
+	}
+	if c.compressor() != "" && encoding.GetCompressor(c.compressor()) == nil {
+		errs = append(errs, fmt.Errorf("unsupported ingest compression %q", c.Compression))
+	}
+	return errors.Join(errs...)
+}
+
+// compressor the compressor of the Ingest calls, empty when they are sent uncompressed
+func (c IngestConfig) compressor() string {
+	if c.Compression == NoCompression {
+		return ""
+	}
+	return c.Compression
+}
@@ -0,0 +1,252 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrSpoolFull = errors.New("ingest spool is full")
+
+// spooledBatch is an Ingest batch that could not be delivered, kept on disk until it can be replayed
+type spooledBatch struct {
+	JobID       uint              `json:"job_id"`
+	ResourceIDs []string          `json:"resource_ids"`
+	Docs        []json.RawMessage `json:"docs"`
+}
+
+// IngestSpool is a bounded on-disk queue of the undelivered Ingest batches of one job, batches are replayed in the
+// order they were spooled. The batches of a job live in their own directory under the spool directory, a job run
+// again after the worker died finds and replays the batches of its previous run. The bound covers the batches of
+// every job in the spool directory
+type IngestSpool struct {
+	root    string
+	dir     string
+	maxSize int64
+
+	lock sync.Mutex
+	seq  uint64
+	// resources spooled by the previous runs of the job when the spool was opened
+	resources int
+}
+
+// OpenIngestSpool opens the spool of the job, the directories of the jobs that did not run for SpoolMaxAge are
+// removed
+func OpenIngestSpool(config IngestConfig, jobID uint) (*IngestSpool, error) {
+	s := &IngestSpool{
+		root:    config.SpoolDir,
+		dir:     filepath.Join(config.SpoolDir, fmt.Sprintf("job-%d", jobID)),
+		maxSize: config.SpoolMaxMiB * 1024 * 1024,
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	if err := s.prune(config.SpoolMaxAge); err != nil {
+		return nil, err
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		seq, resources, ok := parseBatchName(filepath.Base(file))
+		if !ok {
+			continue
+		}
+		s.seq = max(s.seq, seq)
+		s.resources += resources
+	}
+	return s, nil
+}
+
+// Push writes the batch to disk, ErrSpoolFull is returned when it would not fit in the spool
+func (s *IngestSpool) Push(batch spooledBatch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	size, err := s.size()
+	if err != nil {
+		return err
+	}
+	if size+int64(len(data)) > s.maxSize {
+		return ErrSpoolFull
+	}
+
+	s.seq++
+	// the resource count is part of the name so a batch that can not be read is still accounted for
+	name := fmt.Sprintf("%020d-%d.json", s.seq, len(batch.ResourceIDs))
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write batch: %w", err)
+	}
+	if err = os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write batch: %w", err)
+	}
+	return nil
+}
+
+// Replay hands the spooled batches to send oldest first, a batch is removed once sent and replay stops at the
+// first failure so the order is kept for the next attempt. Batches that can not be read are removed, the number
+// of their resources is returned as lost. send runs without holding the spool lock
+func (s *IngestSpool) Replay(send func(batch spooledBatch) error) (lost int, err error) {
+	s.lock.Lock()
+	files, err := s.files()
+	s.lock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range files {
+		_, resources, _ := parseBatchName(filepath.Base(file))
+
+		var batch spooledBatch
+		data, err := os.ReadFile(file)
+		if err == nil {
+			err = json.Unmarshal(data, &batch)
+		}
+		if err != nil {
+			// a corrupted batch can never be delivered, keeping it would block the whole spool
+			if err = s.remove(file); err != nil {
+				return lost, err
+			}
+			lost += resources
+			continue
+		}
+
+		if err = send(batch); err != nil {
+			return lost, err
+		}
+		if err = s.remove(file); err != nil {
+			return lost, err
+		}
+	}
+	return lost, nil
+}
+
+// Resources number of resources the previous runs of the job left in the spool
+func (s *IngestSpool) Resources() int {
+	return s.resources
+}
+
+// Len number of batches waiting in the spool
+func (s *IngestSpool) Len() (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.files()
+	return len(files), err
+}
+
+// Close removes the directory of the job once every batch was replayed, the batches left are kept for the next
+// run of the job
+func (s *IngestSpool) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.files()
+	if err != nil || len(files) > 0 {
+		return err
+	}
+	return os.RemoveAll(s.dir)
+}
+
+func (s *IngestSpool) remove(file string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := os.Remove(file); err != nil {
+		return fmt.Errorf("failed to remove replayed batch: %w", err)
+	}
+	return nil
+}
+
+// files the batches of the job oldest first, none once the spool is closed
+func (s *IngestSpool) files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		files = append(files, filepath.Join(s.dir, entry.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// size of the batches of every job in the spool directory
+func (s *IngestSpool) size() (int64, error) {
+	jobs, err := os.ReadDir(s.root)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var size int64
+	for _, job := range jobs {
+		if !job.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.root, job.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			size += info.Size()
+		}
+	}
+	return size, nil
+}
+
+// prune removes the directories of the other jobs untouched for maxAge
+func (s *IngestSpool) prune(maxAge time.Duration) error {
+	jobs, err := os.ReadDir(s.root)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	for _, job := range jobs {
+		dir := filepath.Join(s.root, job.Name())
+		if !job.IsDir() || !strings.HasPrefix(job.Name(), "job-") || dir == s.dir {
+			continue
+		}
+		info, err := job.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err = os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove stale spool directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseBatchName reads the sequence number and the resource count of a batch from its file name
+func parseBatchName(name string) (seq uint64, resources int, ok bool) {
+	_, err := fmt.Sscanf(strings.TrimSuffix(name, ".json"), "%d-%d", &seq, &resources)
+	return seq, resources, err == nil
+}
@@ -0,0 +1,370 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opengovern/og-util/pkg/es"
+	"go.uber.org/zap"
+)
+
+func testBatch(jobID uint, resourceIDs ...string) spooledBatch {
+	batch := spooledBatch{JobID: jobID, ResourceIDs: resourceIDs}
+	for _, resourceID := range resourceIDs {
+		batch.Docs = append(batch.Docs, json.RawMessage(`{"resource_id":"`+resourceID+`"}`))
+	}
+	return batch
+}
+
+func testIngestConfig(t *testing.T) IngestConfig {
+	return IngestConfig{SpoolDir: t.TempDir(), SpoolMaxMiB: 1, SpoolMaxAge: time.Hour}
+}
+
+func openTestSpool(t *testing.T, config IngestConfig, jobID uint) *IngestSpool {
+	spool, err := OpenIngestSpool(config, jobID)
+	if err != nil {
+		t.Fatalf("open spool: %v", err)
+	}
+	return spool
+}
+
+func spoolLen(t *testing.T, spool *IngestSpool) int {
+	n, err := spool.Len()
+	if err != nil {
+		t.Fatalf("spool len: %v", err)
+	}
+	return n
+}
+
+func TestIngestSpoolReplayKeepsOrderOnFailure(t *testing.T) {
+	spool := openTestSpool(t, testIngestConfig(t), 1)
+	for _, resourceID := range []string{"a", "b", "c"} {
+		if err := spool.Push(testBatch(1, resourceID)); err != nil {
+			t.Fatalf("push %s: %v", resourceID, err)
+		}
+	}
+
+	var replayed []string
+	_, err := spool.Replay(func(batch spooledBatch) error {
+		if batch.ResourceIDs[0] == "b" {
+			// spooled while replaying, it must come after the batches not replayed yet
+			if err := spool.Push(testBatch(1, "d")); err != nil {
+				t.Fatalf("push d: %v", err)
+			}
+			return errors.New("unavailable")
+		}
+		replayed = append(replayed, batch.ResourceIDs[0])
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected the replay to fail")
+	}
+	if fmt.Sprint(replayed) != "[a]" {
+		t.Fatalf("replayed %v, want [a]", replayed)
+	}
+
+	replayed = nil
+	if _, err = spool.Replay(func(batch spooledBatch) error {
+		replayed = append(replayed, batch.ResourceIDs[0])
+		return nil
+	}); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if fmt.Sprint(replayed) != "[b c d]" {
+		t.Fatalf("replayed %v, want [b c d]", replayed)
+	}
+	if n := spoolLen(t, spool); n != 0 {
+		t.Fatalf("spool has %d batches left", n)
+	}
+}
+
+func TestIngestSpoolFullAcrossJobs(t *testing.T) {
+	config := testIngestConfig(t)
+	big := spooledBatch{JobID: 1, ResourceIDs: []string{"a"}, Docs: []json.RawMessage{
+		json.RawMessage(`"` + strings.Repeat("x", 768*1024) + `"`),
+	}}
+	spool := openTestSpool(t, config, 1)
+	if err := spool.Push(big); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	// the bound covers the batches of every job
+	other := openTestSpool(t, config, 2)
+	big.JobID = 2
+	if err := other.Push(big); !errors.Is(err, ErrSpoolFull) {
+		t.Fatalf("push into a full spool returned %v, want ErrSpoolFull", err)
+	}
+
+	if _, err := spool.Replay(func(spooledBatch) error { return nil }); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if err := other.Push(big); err != nil {
+		t.Fatalf("push after replay: %v", err)
+	}
+}
+
+func TestIngestSpoolSurvivesRestart(t *testing.T) {
+	config := testIngestConfig(t)
+	spool := openTestSpool(t, config, 1)
+	for _, resourceID := range []string{"a", "b"} {
+		if err := spool.Push(testBatch(1, resourceID, resourceID+"2")); err != nil {
+			t.Fatalf("push %s: %v", resourceID, err)
+		}
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened := openTestSpool(t, config, 1)
+	if reopened.Resources() != 4 {
+		t.Fatalf("reopened spool holds %d resources, want 4", reopened.Resources())
+	}
+	if err := reopened.Push(testBatch(1, "c")); err != nil {
+		t.Fatalf("push c: %v", err)
+	}
+	var replayed []string
+	if _, err := reopened.Replay(func(batch spooledBatch) error {
+		replayed = append(replayed, batch.ResourceIDs[0])
+		return nil
+	}); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if fmt.Sprint(replayed) != "[a b c]" {
+		t.Fatalf("replayed %v, want [a b c]", replayed)
+	}
+
+	if err := reopened.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := os.Stat(reopened.dir); !os.IsNotExist(err) {
+		t.Fatalf("empty spool directory left behind: %v", err)
+	}
+}
+
+func TestIngestSpoolDropsCorruptedBatches(t *testing.T) {
+	spool := openTestSpool(t, testIngestConfig(t), 1)
+	if err := spool.Push(testBatch(1, "a")); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(spool.dir, fmt.Sprintf("%020d-3.json", 0)), []byte("{"), 0600); err != nil {
+		t.Fatalf("write corrupted batch: %v", err)
+	}
+
+	var replayed []string
+	lost, err := spool.Replay(func(batch spooledBatch) error {
+		replayed = append(replayed, batch.ResourceIDs[0])
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if lost != 3 || fmt.Sprint(replayed) != "[a]" {
+		t.Fatalf("replay lost %d and replayed %v, want 3 and [a]", lost, replayed)
+	}
+}
+
+func TestIngestSpoolPrunesStaleJobs(t *testing.T) {
+	config := testIngestConfig(t)
+	stale := openTestSpool(t, config, 1)
+	if err := stale.Push(testBatch(1, "a")); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	old := time.Now().Add(-2 * config.SpoolMaxAge)
+	if err := os.Chtimes(stale.dir, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	openTestSpool(t, config, 2)
+	if _, err := os.Stat(stale.dir); !os.IsNotExist(err) {
+		t.Fatalf("stale spool directory kept: %v", err)
+	}
+}
+
+// ingestionPipeline fakes the ingestion pipeline, it answers 503 while failing, 400 while rejecting and records
+// the job of every accepted request
+type ingestionPipeline struct {
+	failing   atomic.Bool
+	rejecting atomic.Bool
+	requests  atomic.Int64
+
+	lock     sync.Mutex
+	accepted map[uint]int
+}
+
+func newIngestionPipeline(t *testing.T) (*ingestionPipeline, *httptest.Server) {
+	p := &ingestionPipeline{accepted: make(map[uint]int)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests.Add(1)
+		if p.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if p.rejecting.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		jobID, _ := strconv.ParseUint(r.Header.Get("resource-job-id"), 10, 64)
+		p.lock.Lock()
+		p.accepted[uint(jobID)]++
+		p.lock.Unlock()
+		_, _ = w.Write([]byte(`{"errors":false}`))
+	}))
+	t.Cleanup(server.Close)
+	return p, server
+}
+
+func (p *ingestionPipeline) acceptedOf(jobID uint) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.accepted[jobID]
+}
+
+func newTestResourceSender(t *testing.T, endpoint string, jobID uint) *ResourceSender {
+	return newTestResourceSenderWithSpool(t, endpoint, jobID, testIngestConfig(t))
+}
+
+func newTestResourceSenderWithSpool(t *testing.T, endpoint string, jobID uint, ingest IngestConfig) *ResourceSender {
+	s, err := NewResourceSender("localhost:0", endpoint, "", jobID, nil, true, ingest, GrpcTLSConfig{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("new resource sender: %v", err)
+	}
+	s.retryBackoff = time.Millisecond
+	return s
+}
+
+// sendFullBatch sends one resource more than the buffer holds so the handler flushes a batch right away
+func sendFullBatch(t *testing.T, s *ResourceSender) {
+	for i := 0; i <= MaxBufferSize; i++ {
+		err := s.Send(context.Background(), &es.Resource{
+			ResourceID:    fmt.Sprintf("%d-%d", s.jobID, i),
+			IntegrationID: "integration",
+			ResourceType:  "semgrep/finding",
+		})
+		if err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestResourceSenderReplaysItsOwnSpool(t *testing.T) {
+	pipeline, server := newIngestionPipeline(t)
+	spooling := newTestResourceSender(t, server.URL, 1)
+	other := newTestResourceSender(t, server.URL, 2)
+
+	pipeline.failing.Store(true)
+	sendFullBatch(t, spooling)
+	waitFor(t, func() bool { return spoolLen(t, spooling.spool) == 1 })
+	pipeline.failing.Store(false)
+
+	// the other job delivers its resources without touching the spool of the first one
+	sendFullBatch(t, other)
+	if err := other.Finish(context.Background()); err != nil {
+		t.Fatalf("finish other job: %v", err)
+	}
+	if got := len(other.GetResourceIDs()); got != MaxBufferSize+1 {
+		t.Fatalf("other job delivered %d resources, want %d", got, MaxBufferSize+1)
+	}
+	if got := pipeline.acceptedOf(1); got != 0 {
+		t.Fatalf("%d batches of the spooling job were sent by the other job", got)
+	}
+
+	if err := spooling.Finish(context.Background()); err != nil {
+		t.Fatalf("finish spooling job: %v", err)
+	}
+	if got := len(spooling.GetResourceIDs()); got != MaxBufferSize+1 {
+		t.Fatalf("spooling job delivered %d resources, want %d", got, MaxBufferSize+1)
+	}
+	if got := pipeline.acceptedOf(1); got != 1 {
+		t.Fatalf("spooling job replayed %d batches, want 1", got)
+	}
+}
+
+func TestResourceSenderReportsUnreplayedSpool(t *testing.T) {
+	pipeline, server := newIngestionPipeline(t)
+	s := newTestResourceSender(t, server.URL, 1)
+
+	pipeline.failing.Store(true)
+	sendFullBatch(t, s)
+
+	err := s.Finish(context.Background())
+	var ingestErr Error
+	if !errors.As(err, &ingestErr) || ingestErr.ErrCode != IngestFailedErrCode {
+		t.Fatalf("finish returned %v, want an %s error", err, IngestFailedErrCode)
+	}
+	if !IsRetryable(err) {
+		t.Fatal("resources left in the spool must be retryable")
+	}
+	if len(s.GetResourceIDs()) != 0 {
+		t.Fatalf("%d resources reported as delivered", len(s.GetResourceIDs()))
+	}
+}
+
+func TestResourceSenderReportsRejectedResources(t *testing.T) {
+	pipeline, server := newIngestionPipeline(t)
+	s := newTestResourceSender(t, server.URL, 1)
+
+	pipeline.rejecting.Store(true)
+	sendFullBatch(t, s)
+
+	err := s.Finish(context.Background())
+	var ingestErr Error
+	if !errors.As(err, &ingestErr) || ingestErr.ErrCode != IngestRejectedErrCode {
+		t.Fatalf("finish returned %v, want an %s error", err, IngestRejectedErrCode)
+	}
+	if IsRetryable(err) {
+		t.Fatal("resources the sink rejected must not be retryable")
+	}
+	if n := spoolLen(t, s.spool); n != 0 {
+		t.Fatalf("%d rejected batches spooled", n)
+	}
+	if got := pipeline.requests.Load(); got != 1 {
+		t.Fatalf("rejected batch sent %d times, want 1", got)
+	}
+}
+
+func TestResourceSenderReplaysSpoolOfPreviousRun(t *testing.T) {
+	pipeline, server := newIngestionPipeline(t)
+	ingest := testIngestConfig(t)
+
+	pipeline.failing.Store(true)
+	previous := newTestResourceSenderWithSpool(t, server.URL, 1, ingest)
+	sendFullBatch(t, previous)
+	if err := previous.Finish(context.Background()); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	pipeline.failing.Store(false)
+
+	// the job runs again after the sink recovered, without describing anything new
+	s := newTestResourceSenderWithSpool(t, server.URL, 1, ingest)
+	if err := s.Finish(context.Background()); err != nil {
+		t.Fatalf("finish: %v", err)
+	}
+	if got := len(s.GetResourceIDs()); got != MaxBufferSize+1 {
+		t.Fatalf("second run delivered %d resources, want %d", got, MaxBufferSize+1)
+	}
+	if _, err := os.Stat(s.spool.dir); !os.IsNotExist(err) {
+		t.Fatalf("spool directory of the job kept after replay: %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+)
+
+const (
+	// maxPipelineErrorBody caps how much of a failed response body ends up in the error
+	maxPipelineErrorBody = 1024
+)
+
+// IngestionPipelineError is returned when the ingestion pipeline rejects a whole bulk request
+type IngestionPipelineError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e IngestionPipelineError) Error() string {
+	return fmt.Sprintf("ingestion pipeline responded with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable throttling and server side failures are worth retrying, anything else will fail the same way again
+func (e IngestionPipelineError) Retryable() bool {
+	return isRetryableStatus(e.StatusCode)
+}
+
+// bulkDocHeader fields of an es.Doc needed to build the bulk action line
+type bulkDocHeader struct {
+	EsID       string `json:"es_id"`
+	EsIndex    string `json:"es_index"`
+	ResourceID string `json:"resource_id"`
+}
+
+type bulkItem struct {
+	ID     string          `json:"_id"`
+	Index  string          `json:"_index"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Errors bool                  `json:"errors"`
+	Items  []map[string]bulkItem `json:"items"`
+}
+
+// buildBulkBody renders the docs as an OpenSearch bulk NDJSON body, every doc is preceded by its index action
+func buildBulkBody(docs []json.RawMessage) ([]byte, []bulkDocHeader, error) {
+	var body bytes.Buffer
+	headers := make([]bulkDocHeader, 0, len(docs))
+	for _, doc := range docs {
+		var header bulkDocHeader
+		if err := json.Unmarshal(doc, &header); err != nil {
+			return nil, nil, fmt.Errorf("failed to read document header: %w", err)
+		}
+
+		action, err := json.Marshal(map[string]map[string]string{
+			"index": {
+				"_index": header.EsIndex,
+				"_id":    header.EsID,
+			},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+		headers = append(headers, header)
+	}
+	return body.Bytes(), headers, nil
+}
+
+// ingestToPipeline posts the batch to the ingestion pipeline endpoint and returns the IDs of the resources
+// whose documents were permanently rejected, documents failing with a retryable status fail the whole call
+func (s *ResourceSender) ingestToPipeline(batch spooledBatch) ([]string, error) {
+	body, headers, err := buildBulkBody(batch.Docs)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := s.postBulk(s.stopCtx, body, batch.JobID)
+	if err != nil {
+		return nil, err
+	}
+
+	// pipelines that are not bulk compatible answer with an empty or non json body, nothing to inspect then
+	var bulkRes bulkResponse
+	if len(resBody) == 0 || json.Unmarshal(resBody, &bulkRes) != nil || !bulkRes.Errors {
+		return nil, nil
+	}
+
+	rejected := make(map[string]struct{})
+	var retryable int
+	for i, item := range bulkRes.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status < 300 {
+				continue
+			}
+
+			resourceID := ""
+			if i < len(headers) {
+				resourceID = headers[i].ResourceID
+			}
+			if isRetryableStatus(result.Status) {
+				retryable++
+				continue
+			}
+			s.logger.Error("ingestion pipeline rejected document", zap.String("resourceID", resourceID),
+				zap.String("index", result.Index), zap.Int("status", result.Status), zap.String("error", string(result.Error)))
+			rejected[resourceID] = struct{}{}
+		}
+	}
+	if retryable > 0 {
+		return nil, IngestionPipelineError{
+			StatusCode: http.StatusTooManyRequests,
+			Body:       fmt.Sprintf("%d documents failed with a retryable status", retryable),
+		}
+	}
+
+	rejectedIDs := make([]string, 0, len(rejected))
+	for _, resourceID := range batch.ResourceIDs {
+		if _, ok := rejected[resourceID]; ok {
+			rejectedIDs = append(rejectedIDs, resourceID)
+		}
+	}
+	return rejectedIDs, nil
+}
+
+// deleteFromPipeline removes the documents with bulk delete actions, documents that are already gone are fine
+func (s *ResourceSender) deleteFromPipeline(ctx context.Context, docs []bulkDocHeader) error {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		action, err := json.Marshal(map[string]map[string]string{
+			"delete": {
+				"_index": doc.EsIndex,
+				"_id":    doc.EsID,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+	}
+
+	resBody, err := s.postBulk(ctx, body.Bytes(), s.jobID)
+	if err != nil {
+		return err
+	}
+
+	var bulkRes bulkResponse
+	if len(resBody) == 0 || json.Unmarshal(resBody, &bulkRes) != nil || !bulkRes.Errors {
+		return nil
+	}
+	var failed int
+	for _, item := range bulkRes.Items {
+		for _, result := range item {
+			if (result.Status >= 200 && result.Status < 300) || result.Status == http.StatusNotFound {
+				continue
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return IngestionPipelineError{
+			StatusCode: http.StatusInternalServerError,
+			Body:       fmt.Sprintf("failed to delete %d documents", failed),
+		}
+	}
+	return nil
+}
+
+// postBulk posts a bulk body to the ingestion pipeline endpoint and returns the response body of a successful call
+func (s *ResourceSender) postBulk(ctx context.Context, body []byte, jobID uint) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.ingestionPipelineEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ingestion pipeline request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("resource-job-id", fmt.Sprintf("%d", jobID))
+	if s.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.authToken)
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send to ingestion pipeline: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ingestion pipeline response: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		if len(resBody) > maxPipelineErrorBody {
+			resBody = resBody[:maxPipelineErrorBody]
+		}
+		return nil, IngestionPipelineError{StatusCode: res.StatusCode, Body: string(resBody)}
+	}
+	return resBody, nil
+}
+
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// isRetryableIngestError only the ingestion pipeline reports permanent failures, gRPC errors are always retried
+func isRetryableIngestError(err error) bool {
+	var pipelineErr IngestionPipelineError
+	if errors.As(err, &pipelineErr) {
+		return pipelineErr.Retryable()
+	}
+	return true
+}
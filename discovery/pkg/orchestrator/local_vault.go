@@ -0,0 +1,141 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/opengovern/og-util/pkg/vault"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// LocalVault reads the integration credentials from the developer machine, never use it in production. It is
+// rejected unless the worker opted in with WithLocalVault. The vault key id selects where they come from:
+//   - empty: the job cipher text itself is the plaintext (or base64 encoded) credentials JSON
+//   - file:///path/to/credentials.json: a plaintext JSON file
+//   - env://VARIABLE: an environment variable holding the JSON
+//   - age:///path/to/credentials.json.age?identity=/path/to/key.txt: a file encrypted with age, decrypted by
+//     the age CLI with the given identity or the one in AGE_IDENTITY_FILE. The worker image does not ship the
+//     age CLI, the scheme is only available where it is installed
+const LocalVault vault.Provider = "local"
+
+var (
+	localVaultKey string = "localVault"
+)
+
+// WithLocalVault lets the jobs read their credentials with LocalVault, only for workers on a developer machine
+func WithLocalVault(ctx context.Context) context.Context {
+	return context.WithValue(ctx, localVaultKey, true)
+}
+
+func localVaultAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(localVaultKey).(bool)
+	return allowed
+}
+
+type LocalVaultSourceConfig struct {
+	keyID string
+}
+
+func NewLocalVaultSourceConfig(keyID string) (*LocalVaultSourceConfig, error) {
+	if keyID != "" {
+		u, err := url.Parse(keyID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local vault key id: %w", err)
+		}
+		switch u.Scheme {
+		case "file", "env":
+		case "age":
+			if _, err = exec.LookPath("age"); err != nil {
+				return nil, fmt.Errorf("local vault source age:// needs the age CLI, it is not installed: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported local vault source %q, expected file://, env:// or age://", u.Scheme)
+		}
+	}
+	return &LocalVaultSourceConfig{keyID: keyID}, nil
+}
+
+// Encrypt only produces the plaintext form, the other sources are managed by hand
+func (c *LocalVaultSourceConfig) Encrypt(_ context.Context, data map[string]any) (string, error) {
+	if c.keyID != "" {
+		return "", fmt.Errorf("local vault can only encrypt into the job cipher text")
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(dataJSON), nil
+}
+
+func (c *LocalVaultSourceConfig) Decrypt(ctx context.Context, cypherText string) (map[string]any, error) {
+	plaintext, err := c.read(ctx, cypherText)
+	if err != nil {
+		return nil, err
+	}
+
+	var config map[string]any
+	if err = json.Unmarshal(plaintext, &config); err != nil {
+		return nil, fmt.Errorf("local vault credentials are not a JSON object: %w", err)
+	}
+	return config, nil
+}
+
+func (c *LocalVaultSourceConfig) read(ctx context.Context, cypherText string) ([]byte, error) {
+	if c.keyID == "" {
+		cypherText = strings.TrimSpace(cypherText)
+		if strings.HasPrefix(cypherText, "{") {
+			return []byte(cypherText), nil
+		}
+		plaintext, err := base64.StdEncoding.DecodeString(cypherText)
+		if err != nil {
+			return nil, fmt.Errorf("job cipher text is neither JSON nor base64 encoded JSON")
+		}
+		return plaintext, nil
+	}
+
+	u, err := url.Parse(c.keyID)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		plaintext, err := os.ReadFile(u.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials file: %w", err)
+		}
+		return plaintext, nil
+	case "env":
+		plaintext, ok := os.LookupEnv(u.Host)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", u.Host)
+		}
+		return []byte(plaintext), nil
+	case "age":
+		return decryptAgeFile(ctx, u.Path, u.Query().Get("identity"))
+	default:
+		return nil, fmt.Errorf("unsupported local vault source %q", u.Scheme)
+	}
+}
+
+func decryptAgeFile(ctx context.Context, path, identity string) ([]byte, error) {
+	if identity == "" {
+		identity = os.Getenv("AGE_IDENTITY_FILE")
+	}
+	if identity == "" {
+		return nil, fmt.Errorf("no age identity given, set the identity query parameter or AGE_IDENTITY_FILE")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "age", "--decrypt", "--identity", identity, path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s with age: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,25 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLocalVaultNeedsOptIn(t *testing.T) {
+	if localVaultAllowed(context.Background()) {
+		t.Fatal("local vault allowed without opt-in")
+	}
+	if !localVaultAllowed(WithLocalVault(context.Background())) {
+		t.Fatal("local vault not allowed after opt-in")
+	}
+}
+
+func TestLocalVaultRejectsAgeWithoutCLI(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := NewLocalVaultSourceConfig("age:///credentials.json.age"); err == nil {
+		t.Fatal("expected age:// to be rejected without the age CLI")
+	}
+	if _, err := NewLocalVaultSourceConfig("env://CREDENTIALS"); err != nil {
+		t.Fatalf("env source: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package orchestrator
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	DocumentFailureRejected = "rejected"
+	DocumentFailureSpooled  = "spooled"
+	DocumentFailureLost     = "lost"
+)
+
+var (
+	documentsSent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "og_describer_semgrep_documents_sent_total",
+		Help: "Resources delivered to the ingestion backend",
+	})
+	documentsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "og_describer_semgrep_documents_failed_total",
+		Help: "Resources not delivered: rejected by the backend, spooled for a later retry or lost",
+	}, []string{"reason"})
+)
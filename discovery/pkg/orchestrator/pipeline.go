@@ -0,0 +1,254 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/opengovern/og-describer-semgrep/discovery/pkg/jsonschema"
+	model "github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
+	"github.com/opengovern/og-describer-semgrep/discovery/provider"
+	"github.com/opengovern/og-describer-semgrep/global"
+	describe2 "github.com/opengovern/og-util/pkg/describe"
+	"github.com/opengovern/og-util/pkg/es"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"go.uber.org/zap"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResourcePipeline transforms the resources streamed by the describers into es.Resource documents
+// and hands them to a ResourceSink, it is shared by the describe worker and the local CLI
+type ResourcePipeline struct {
+	logger            *zap.Logger
+	job               describe2.DescribeJob
+	plg               *plugin.Plugin
+	descriptionSchema *jsonschema.Schema
+	redaction         RedactionPolicy
+	// tagFields the Tags of the resource type, the fields canonical tags are read from
+	tagFields map[string][]string
+
+	invalidResources int
+	describedIDs     []string
+
+	// previousHashes enables the change detection, resources whose hash did not change are not sent again
+	previousHashes map[string]string
+	hashes         map[string]string
+	unchangedIDs   []string
+}
+
+func NewResourcePipeline(logger *zap.Logger, job describe2.DescribeJob) (*ResourcePipeline, error) {
+	descriptionSchema, err := global.DescriptionSchema(job.ResourceType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build description schema: %w", err)
+	}
+
+	resourceType, err := GetResourceType(job.ResourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	redaction, err := GetRedactionPolicy(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build redaction policy: %w", err)
+	}
+
+	logger.Info("Connect to steampipe plugin")
+	return &ResourcePipeline{
+		logger:            logger,
+		job:               job,
+		plg:               global.Plugin(),
+		descriptionSchema: descriptionSchema,
+		redaction:         redaction,
+		tagFields:         resourceType.Tags,
+		hashes:            make(map[string]string),
+	}, nil
+}
+
+// StreamSender returns the stream passed to the describers, every resource is transformed and sent to the sink.
+// A failing sink fails the stream so the describers stop instead of describing resources nobody receives
+func (p *ResourcePipeline) StreamSender(ctx context.Context, sink ResourceSink) *model.StreamSender {
+	f := func(resource model.Resource) error {
+		provider.GetProgressFromContext(ctx).AddResource()
+		res, err := p.Transform(resource)
+		if err != nil {
+			return err
+		}
+		if res == nil {
+			return nil
+		}
+
+		hash, err := resourceHash(res)
+		if err != nil {
+			return err
+		}
+		p.hashes[res.ResourceID] = hash
+		if previousHash, ok := p.previousHashes[res.ResourceID]; ok && previousHash == hash {
+			p.unchangedIDs = append(p.unchangedIDs, res.ResourceID)
+			return nil
+		}
+
+		if err = sink.Send(ctx, res); err != nil {
+			return fmt.Errorf("failed to send resource %s: %w", res.ResourceID, err)
+		}
+		return nil
+	}
+	return (*model.StreamSender)(&f)
+}
+
+// SetPreviousHashes enables the change detection against the hashes of the previous describe
+func (p *ResourcePipeline) SetPreviousHashes(hashes map[string]string) {
+	p.previousHashes = hashes
+}
+
+// IndexedHashes the hashes of the given resources only, a resource whose document did not make it to the index must
+// not be skipped as unchanged by the next describe
+func (p *ResourcePipeline) IndexedHashes(indexedIDs []string) map[string]string {
+	hashes := make(map[string]string, len(indexedIDs))
+	for _, id := range indexedIDs {
+		if hash, ok := p.hashes[id]; ok {
+			hashes[id] = hash
+		}
+	}
+	return hashes
+}
+
+// UnchangedResourceIDs resources not sent because they did not change since the previous describe
+func (p *ResourcePipeline) UnchangedResourceIDs() []string {
+	return p.unchangedIDs
+}
+
+// InvalidResources number of resources skipped because their description did not match the schema
+func (p *ResourcePipeline) InvalidResources() int {
+	return p.invalidResources
+}
+
+// DescribedResourceIDs IDs of every resource the describers found, including the skipped invalid ones
+func (p *ResourcePipeline) DescribedResourceIDs() []string {
+	return p.describedIDs
+}
+
+// Transform builds the es.Resource of a described resource, a nil result means the resource must be skipped
+func (p *ResourcePipeline) Transform(resource model.Resource) (*es.Resource, error) {
+	job := p.job
+	logger := p.logger
+
+	if resource.Description == nil {
+		return nil, nil
+	}
+	p.describedIDs = append(p.describedIDs, resource.UniqueID())
+	descriptionJSON, err := json.Marshal(resource.Description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal description: %w", err)
+	}
+	descriptionJSON, err = trimJsonFromEmptyObjects(descriptionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to trim json: %w", err)
+	}
+
+	err = provider.AdjustResource(job, &resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to adjust resource")
+	}
+	metadata, err := provider.GetResourceMetadata(job, resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource metadata")
+	}
+
+	desc := resource.Description
+	err = json.Unmarshal(descriptionJSON, &desc)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal description: %v", err.Error())
+	}
+
+	tags := make(map[string]string)
+
+	if p.plg != nil {
+		tags, _, err = global.ExtractTagsAndNames(logger, p.plg, job.ResourceType, resource)
+		if err != nil {
+			logger.Error("failed to build tags for service", zap.Error(err), zap.String("resourceType", job.ResourceType), zap.Any("resource", resource))
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+	}
+
+	resourceTags, err := provider.GetResourceTags(job, resource, p.tagFields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource tags: %w", err)
+	}
+	for k, v := range resourceTags {
+		tags[k] = v
+	}
+
+	var description any
+	err = json.Unmarshal([]byte(descriptionJSON), &description)
+	if err != nil {
+		logger.Error("failed to parse resource description json", zap.Error(err))
+		return nil, fmt.Errorf("failed to parse resource description json")
+	}
+
+	// Semgrep API shape changes decode into zero values silently, keep such documents out of the index
+	if violations := p.descriptionSchema.Validate(description); len(violations) > 0 {
+		p.invalidResources++
+		logger.Warn("resource description does not match its schema", zap.String("resourceType", job.ResourceType),
+			zap.String("resourceID", resource.UniqueID()), zap.Strings("violations", violations))
+		return nil, nil
+	}
+	// redacted after the validation, a dropped field must not make the description invalid
+	p.redaction.Apply(description)
+	p.redaction.ApplyToMetadata(metadata)
+	p.redaction.ApplyToTags(tags)
+
+	newTags := make([]es.Tag, 0, len(tags))
+	for k, v := range tags {
+		newTags = append(newTags, es.Tag{
+			// tags should be case-insensitive
+			Key:   strings.ToLower(k),
+			Value: strings.ToLower(v),
+		})
+	}
+
+	return &es.Resource{
+		PlatformID:      fmt.Sprintf("%s:::%s:::%s", job.IntegrationID, job.ResourceType, resource.UniqueID()),
+		ResourceID:      resource.UniqueID(),
+		ResourceName:    resource.Name,
+		Description:     description,
+		IntegrationType: global.IntegrationName,
+		ResourceType:    strings.ToLower(job.ResourceType),
+		IntegrationID:   job.IntegrationID,
+		Metadata:        metadata,
+		CanonicalTags:   newTags,
+		DescribedAt:     job.DescribedAt,
+		DescribedBy:     strconv.FormatUint(uint64(job.JobID), 10),
+	}, nil
+}
+
+// resourceHash hashes what ends up in the indexed document apart from the describe job details,
+// encoding/json sorts the map keys so the same content always gives the same hash
+func resourceHash(resource *es.Resource) (string, error) {
+	tags := make([]es.Tag, len(resource.CanonicalTags))
+	copy(tags, resource.CanonicalTags)
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Key != tags[j].Key {
+			return tags[i].Key < tags[j].Key
+		}
+		return tags[i].Value < tags[j].Value
+	})
+
+	content, err := json.Marshal(struct {
+		Name        string            `json:"name"`
+		Description any               `json:"description"`
+		Metadata    map[string]string `json:"metadata"`
+		Tags        []es.Tag          `json:"tags"`
+	}{
+		Name:        resource.ResourceName,
+		Description: resource.Description,
+		Metadata:    resource.Metadata,
+		Tags:        tags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal resource content: %w", err)
+	}
+	return es.HashOf(string(content)), nil
+}
@@ -0,0 +1,211 @@
+package orchestrator
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	describe2 "github.com/opengovern/og-util/pkg/describe"
+	"strings"
+)
+
+const (
+	// RedactionLabelPrefix integration labels named "redact:<resource type>" hold the redaction rules of that
+	// resource type as a comma separated list of path:action, e.g.
+	// redact:Semgrep/Finding = "TriageComment:drop, Assistant.Autofix.FixCode:hash, Rule.CWENames[]:mask".
+	// The paths address the description, the metadata and the canonical tags copy some of its fields and are
+	// addressed with RedactionMetadataPrefix and RedactionTagsPrefix, e.g. "@metadata.repository_url:hash"
+	RedactionLabelPrefix = "redact:"
+	// RedactionMetadataPrefix a path starting with it names a metadata key, e.g. @metadata.project_name
+	RedactionMetadataPrefix = "@metadata."
+	// RedactionTagsPrefix a path starting with it names a canonical tag key, e.g. @tags.repository
+	RedactionTagsPrefix = "@tags."
+
+	RedactionMaskValue = "********"
+)
+
+type RedactionAction string
+
+// RedactionTarget the part of the document a rule applies to
+type RedactionTarget string
+
+const (
+	RedactionDescription RedactionTarget = "description"
+	RedactionMetadata    RedactionTarget = "metadata"
+	RedactionTags        RedactionTarget = "tags"
+)
+
+const (
+	// RedactionDrop removes the field from the description
+	RedactionDrop RedactionAction = "drop"
+	// RedactionHash replaces the value with its sha256, equal values can still be correlated
+	RedactionHash RedactionAction = "hash"
+	// RedactionMask replaces strings with RedactionMaskValue and any other value with null
+	RedactionMask RedactionAction = "mask"
+)
+
+// RedactionRule path is a dot separated list of description fields (matched case-insensitively),
+// a field suffixed with [] applies the rest of the path to every element of the array. The path of a metadata
+// or tags rule is the single key it redacts
+type RedactionRule struct {
+	Target RedactionTarget
+	Path   []string
+	Action RedactionAction
+}
+
+type RedactionPolicy []RedactionRule
+
+// GetRedactionPolicy parses the redaction label of the job resource type, invalid rules fail the job
+// rather than letting sensitive fields through
+func GetRedactionPolicy(job describe2.DescribeJob) (RedactionPolicy, error) {
+	var label string
+	for k, v := range job.IntegrationLabels {
+		if strings.HasPrefix(k, RedactionLabelPrefix) && strings.EqualFold(strings.TrimPrefix(k, RedactionLabelPrefix), job.ResourceType) {
+			label = v
+			break
+		}
+	}
+
+	var policy RedactionPolicy
+	for _, rule := range strings.Split(label, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		path, action, ok := strings.Cut(rule, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid redaction rule %q, expected path:action", rule)
+		}
+		action = strings.ToLower(strings.TrimSpace(action))
+		switch RedactionAction(action) {
+		case RedactionDrop, RedactionHash, RedactionMask:
+		default:
+			return nil, fmt.Errorf("invalid redaction action %q in rule %q, expected drop, hash or mask", action, rule)
+		}
+
+		path = strings.TrimSpace(path)
+		target := RedactionDescription
+		if key, ok := cutPrefixFold(path, RedactionMetadataPrefix); ok {
+			target, path = RedactionMetadata, key
+		} else if key, ok = cutPrefixFold(path, RedactionTagsPrefix); ok {
+			target, path = RedactionTags, key
+		}
+		if target != RedactionDescription {
+			if path == "" {
+				return nil, fmt.Errorf("invalid redaction rule %q, expected a %s key", rule, target)
+			}
+			policy = append(policy, RedactionRule{Target: target, Path: []string{path}, Action: RedactionAction(action)})
+			continue
+		}
+
+		var segments []string
+		for _, segment := range strings.Split(path, ".") {
+			if strings.TrimSuffix(segment, "[]") == "" {
+				return nil, fmt.Errorf("invalid redaction path %q", path)
+			}
+			segments = append(segments, segment)
+		}
+		policy = append(policy, RedactionRule{Target: RedactionDescription, Path: segments, Action: RedactionAction(action)})
+	}
+	return policy, nil
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// Apply redacts the decoded description (as produced by json.Unmarshal into an any) in place
+func (p RedactionPolicy) Apply(description any) {
+	for _, rule := range p {
+		if rule.Target == RedactionDescription {
+			redact(description, rule.Path, rule.Action)
+		}
+	}
+}
+
+// ApplyToMetadata redacts the metadata of the document in place
+func (p RedactionPolicy) ApplyToMetadata(metadata map[string]string) {
+	p.applyToKeys(RedactionMetadata, metadata)
+}
+
+// ApplyToTags redacts the canonical tags of the document in place
+func (p RedactionPolicy) ApplyToTags(tags map[string]string) {
+	p.applyToKeys(RedactionTags, tags)
+}
+
+func (p RedactionPolicy) applyToKeys(target RedactionTarget, values map[string]string) {
+	for _, rule := range p {
+		if rule.Target != target {
+			continue
+		}
+		for key, value := range values {
+			if !strings.EqualFold(key, rule.Path[0]) {
+				continue
+			}
+			if rule.Action == RedactionDrop {
+				delete(values, key)
+				continue
+			}
+			values[key] = redactValue(value, rule.Action).(string)
+		}
+	}
+}
+
+func redact(value any, path []string, action RedactionAction) {
+	object, ok := value.(map[string]any)
+	if !ok || len(path) == 0 {
+		return
+	}
+
+	name, each := strings.CutSuffix(path[0], "[]")
+	for key, field := range object {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+
+		switch {
+		case each:
+			items, ok := field.([]any)
+			if !ok {
+				continue
+			}
+			for i, item := range items {
+				if len(path) == 1 {
+					items[i] = redactValue(item, action)
+				} else {
+					redact(item, path[1:], action)
+				}
+			}
+		case len(path) > 1:
+			redact(field, path[1:], action)
+		case action == RedactionDrop:
+			delete(object, key)
+		default:
+			object[key] = redactValue(field, action)
+		}
+	}
+}
+
+func redactValue(value any, action RedactionAction) any {
+	switch action {
+	case RedactionDrop:
+		return nil
+	case RedactionHash:
+		if value == nil {
+			return nil
+		}
+		content, ok := value.(string)
+		if !ok {
+			contentJSON, _ := json.Marshal(value)
+			content = string(contentJSON)
+		}
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	default:
+		if _, ok := value.(string); ok {
+			return RedactionMaskValue
+		}
+		return nil
+	}
+}
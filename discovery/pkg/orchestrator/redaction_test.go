@@ -0,0 +1,50 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+
+	describe2 "github.com/opengovern/og-util/pkg/describe"
+)
+
+func TestRedactionPolicyAppliesToMetadataAndTags(t *testing.T) {
+	policy, err := GetRedactionPolicy(describe2.DescribeJob{
+		ResourceType: "Semgrep/Finding",
+		IntegrationLabels: map[string]string{
+			"redact:Semgrep/Finding": "Repository.URL:drop, @metadata.repository_url:drop, @Metadata.Project_Name:hash, @tags.repository:mask",
+		},
+	})
+	if err != nil {
+		t.Fatalf("policy: %v", err)
+	}
+
+	description := map[string]any{"Repository": map[string]any{"URL": "https://git.example.com/secret", "Name": "secret"}}
+	metadata := map[string]string{"repository_url": "https://git.example.com/secret", "project_name": "secret", "deployment_id": "1"}
+	tags := map[string]string{"repository": "secret", "severity": "high"}
+	policy.Apply(description)
+	policy.ApplyToMetadata(metadata)
+	policy.ApplyToTags(tags)
+
+	if _, ok := description["Repository"].(map[string]any)["URL"]; ok {
+		t.Fatal("description field not dropped")
+	}
+	if _, ok := metadata["repository_url"]; ok {
+		t.Fatal("metadata key not dropped")
+	}
+	if !strings.HasPrefix(metadata["project_name"], "sha256:") || metadata["deployment_id"] != "1" {
+		t.Fatalf("metadata redacted to %v", metadata)
+	}
+	if tags["repository"] != RedactionMaskValue || tags["severity"] != "high" {
+		t.Fatalf("tags redacted to %v", tags)
+	}
+}
+
+func TestRedactionPolicyRejectsEmptyKey(t *testing.T) {
+	_, err := GetRedactionPolicy(describe2.DescribeJob{
+		ResourceType:      "Semgrep/Finding",
+		IntegrationLabels: map[string]string{"redact:Semgrep/Finding": "@tags.:drop"},
+	})
+	if err == nil {
+		t.Fatal("expected an empty tag key to be rejected")
+	}
+}
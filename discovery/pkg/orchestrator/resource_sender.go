@@ -2,7 +2,6 @@ package orchestrator
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,16 +9,17 @@ import (
 	"github.com/opengovern/og-util/pkg/es"
 	"github.com/opengovern/og-util/proto/src/golang"
 	"go.uber.org/zap"
-	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/credentials/oauth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/anypb"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -28,12 +28,29 @@ const (
 	MaxBufferSize   int           = 100
 	ChannelSize     int           = 1000
 	BufferEmptyRate time.Duration = 5 * time.Second
+
+	// MaxBatchBytes keeps an Ingest request well below the 4MB gRPC message limit, a single document above it is rejected
+	MaxBatchBytes int = 3 * 1024 * 1024
+
+	IngestMaxRetries   int           = 5
+	IngestRetryBackoff time.Duration = time.Second
+
+	// IngestFailedErrCode resources were not delivered because the sink failed, describing again may deliver them
+	IngestFailedErrCode = "IngestFailed"
+	// IngestRejectedErrCode resources can never be delivered (e.g. too large or refused by the sink), describing
+	// again would fail the same way
+	IngestRejectedErrCode = "IngestRejected"
+)
+
+var (
+	ErrResourceSenderClosed = errors.New("resource sender is closed")
 )
 
+// ResourceSender is the ResourceSink ingesting resources through the platform EsSinkService over gRPC
 type ResourceSender struct {
 	authToken                 string
 	logger                    *zap.Logger
-	resourceChannel           chan *es.Resource
+	resourceChannel           chan senderRequest
 	resourceIDs               []string
 	doneChannel               chan interface{}
 	conn                      *grpc.ClientConn
@@ -42,18 +59,56 @@ type ResourceSender struct {
 	jobID                     uint
 	params                    map[string]string
 
-	client     golang.EsSinkServiceClient
-	httpClient *http.Client
+	client       golang.EsSinkServiceClient
+	httpClient   *http.Client
+	tlsConfig    GrpcTLSConfig
+	retryBackoff time.Duration
+	// compression is dropped when the sink does not support it
+	compression string
 
-	sendBuffer    []*es.Resource
-	useOpenSearch bool
+	sendBuffer      []bufferedResource
+	sendBufferBytes int
+	useOpenSearch   bool
+
+	// spool the batches of this job that could not be delivered yet, replayed once the backend accepts a batch again
+	// and by the next run of the job if the worker dies first
+	spool *IngestSpool
+	// spooledResources resources waiting in the spool, lostResources resources that could not even be spooled,
+	// rejectedResources resources that can never be delivered
+	spooledResources  int
+	lostResources     int
+	rejectedResources int
+
+	// stopCtx aborts the ingest calls of the handler when Finish gives up waiting for it
+	stopCtx context.Context
+	stop    context.CancelFunc
+
+	// lock guards resourceIDs, read by the worker, and failure, set by the handler once resources can neither be
+	// delivered nor spooled and sending more is pointless
+	lock    sync.Mutex
+	failure error
 }
 
-func NewResourceSender(grpcEndpoint, ingestionPipelineEndpoint string, describeToken string, jobID uint, params map[string]string, useOpenSearch bool, logger *zap.Logger) (*ResourceSender, error) {
+// senderRequest an entry of the resource queue, a resource to send, a flush when flushed is set or the end of
+// the job when both are nil
+type senderRequest struct {
+	resource *es.Resource
+	flushed  chan error
+}
+
+// bufferedResource the serialized documents of a resource waiting for the next flush
+type bufferedResource struct {
+	resourceID string
+	docs       []json.RawMessage
+	size       int
+}
+
+func NewResourceSender(grpcEndpoint, ingestionPipelineEndpoint string, describeToken string, jobID uint, params map[string]string, useOpenSearch bool, ingest IngestConfig, tlsConfig GrpcTLSConfig, logger *zap.Logger) (*ResourceSender, error) {
+	stopCtx, stop := context.WithCancel(context.Background())
 	rs := ResourceSender{
 		authToken:                 describeToken,
 		logger:                    logger,
-		resourceChannel:           make(chan *es.Resource, ChannelSize),
+		resourceChannel:           make(chan senderRequest, ChannelSize),
 		resourceIDs:               nil,
 		doneChannel:               make(chan interface{}),
 		conn:                      nil,
@@ -63,9 +118,34 @@ func NewResourceSender(grpcEndpoint, ingestionPipelineEndpoint string, describeT
 		params:                    params,
 		useOpenSearch:             useOpenSearch,
 
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		tlsConfig:    tlsConfig,
+		retryBackoff: IngestRetryBackoff,
+		compression:  ingest.compressor(),
+		stopCtx:      stopCtx,
+		stop:         stop,
+	}
+	if useOpenSearch && ingestionPipelineEndpoint == "" {
+		stop()
+		return nil, fmt.Errorf("ingestion pipeline endpoint is required when OpenSearch ingestion is enabled")
+	}
+	spool, err := OpenIngestSpool(ingest, jobID)
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to open ingest spool: %w", err)
+	}
+	rs.spool = spool
+	// the batches a previous run left are replayed along with the ones of this run
+	rs.spooledResources = spool.Resources()
+	if rs.spooledResources > 0 {
+		logger.Info("replaying the resources spooled by a previous run", zap.Int("count", rs.spooledResources))
+	}
+	if rs.compression != "" && encoding.GetCompressor(rs.compression) == nil {
+		stop()
+		return nil, fmt.Errorf("unsupported ingest compression %q", rs.compression)
 	}
 	if err := rs.Connect(); err != nil {
+		stop()
 		return nil, err
 	}
 
@@ -74,16 +154,9 @@ func NewResourceSender(grpcEndpoint, ingestionPipelineEndpoint string, describeT
 }
 
 func (s *ResourceSender) Connect() error {
-	var opts []grpc.DialOption
-	if s.authToken != "" {
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})))
-		opts = append(opts, grpc.WithPerRPCCredentials(oauth.TokenSource{
-			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{
-				AccessToken: s.authToken,
-			}),
-		}))
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	opts, err := s.tlsConfig.DialOptions(s.authToken)
+	if err != nil {
+		return fmt.Errorf("failed to set up grpc TLS: %w", err)
 	}
 
 	conn, err := grpc.NewClient(
@@ -93,6 +166,12 @@ func (s *ResourceSender) Connect() error {
 	if err != nil {
 		return err
 	}
+	// reconnecting replaces a broken connection, it is closed so its resources are not leaked
+	if s.conn != nil {
+		if err := s.conn.Close(); err != nil {
+			s.logger.Warn("failed to close previous connection", zap.Error(err))
+		}
+	}
 	s.conn = conn
 
 	client := golang.NewEsSinkServiceClient(conn)
@@ -104,108 +183,425 @@ func (s *ResourceSender) ResourceHandler() {
 	t := time.NewTicker(BufferEmptyRate)
 	defer t.Stop()
 
+	defer close(s.doneChannel)
+
 	for {
 		select {
-		case resource := <-s.resourceChannel:
+		case request := <-s.resourceChannel:
+			if request.flushed != nil {
+				s.flushBuffer(true)
+				request.flushed <- s.undelivered()
+				continue
+			}
+			resource := request.resource
 			if resource == nil {
 				s.flushBuffer(true)
-				s.doneChannel <- struct{}{}
 				return
 			}
 
-			s.resourceIDs = append(s.resourceIDs, resource.ResourceID)
-			s.sendBuffer = append(s.sendBuffer, resource)
+			buffered, err := s.bufferResource(resource)
+			if err != nil {
+				s.logger.Error("failed to prepare resource, it is not sent", zap.String("resourceID", resource.ResourceID), zap.Error(err))
+				s.rejectedResources++
+				documentsFailed.WithLabelValues(DocumentFailureRejected).Inc()
+				continue
+			}
+			if s.sendBufferBytes+buffered.size > MaxBatchBytes {
+				s.flushBuffer(true)
+			}
+			s.sendBuffer = append(s.sendBuffer, buffered)
+			s.sendBufferBytes += buffered.size
 
 			if len(s.sendBuffer) > MaxBufferSize {
 				s.flushBuffer(true)
 			}
 		case <-t.C:
 			s.flushBuffer(false)
+		case <-s.stopCtx.Done():
+			// Finish gave up, the buffered resources are not delivered
+			s.lostResources += len(s.sendBuffer)
+			documentsFailed.WithLabelValues(DocumentFailureLost).Add(float64(len(s.sendBuffer)))
+			s.sendBuffer = nil
+			s.sendBufferBytes = 0
+			return
 		}
 	}
 }
 
-func (s *ResourceSender) sendToBackend(resourcesToSend []es.Doc) {
-	grpcCtx := metadata.NewOutgoingContext(context.Background(), metadata.New(map[string]string{
-		"resource-job-id": fmt.Sprintf("%d", s.jobID),
-	}))
+func (s *ResourceSender) sendToBackend(batch spooledBatch) {
+	resourceIDs := batch.ResourceIDs
+	rejectedIDs, err := s.ingestWithRetry(batch)
+	if err != nil && !isRetryableIngestError(err) {
+		// the sink refused the whole batch, replaying it would fail the same way
+		s.logger.Error("sink rejected the resources", zap.Error(err), zap.Int("count", len(resourceIDs)))
+		s.rejectedResources += len(resourceIDs)
+		documentsFailed.WithLabelValues(DocumentFailureRejected).Add(float64(len(resourceIDs)))
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to send resources, spooling the batch", zap.Error(err), zap.Int("count", len(resourceIDs)))
+		if err = s.spool.Push(batch); err != nil {
+			s.logger.Error("failed to spool resources, they are lost", zap.Error(err), zap.Int("count", len(resourceIDs)))
+			s.lostResources += len(resourceIDs)
+			documentsFailed.WithLabelValues(DocumentFailureLost).Add(float64(len(resourceIDs)))
+			s.setFailure(fmt.Errorf("failed to deliver or spool resources: %w", err))
+			return
+		}
+		s.spooledResources += len(resourceIDs)
+		documentsFailed.WithLabelValues(DocumentFailureSpooled).Add(float64(len(resourceIDs)))
+		return
+	}
+	s.deliver(batch, rejectedIDs)
 
-	docs := make([]*anypb.Any, 0, len(resourcesToSend))
-	for _, resource := range resourcesToSend {
-		docBytes, err := json.Marshal(resource)
-		if err != nil {
-			s.logger.Error("failed to marshal resource", zap.Error(err))
+	s.replaySpool()
+}
+
+// deliver records the resources of a delivered batch, the rejected ones are counted apart
+func (s *ResourceSender) deliver(batch spooledBatch, rejectedIDs []string) {
+	rejected := make(map[string]struct{}, len(rejectedIDs))
+	for _, resourceID := range rejectedIDs {
+		rejected[resourceID] = struct{}{}
+	}
+	for _, resourceID := range batch.ResourceIDs {
+		if _, ok := rejected[resourceID]; ok {
+			s.rejectedResources++
+			documentsFailed.WithLabelValues(DocumentFailureRejected).Inc()
 			continue
 		}
-		docs = append(docs, &anypb.Any{Value: docBytes})
+		s.lock.Lock()
+		s.resourceIDs = append(s.resourceIDs, resourceID)
+		s.lock.Unlock()
+		documentsSent.Inc()
 	}
+}
 
-	_, err := s.client.Ingest(grpcCtx, &golang.IngestRequest{Docs: docs})
-	if err != nil {
-		s.logger.Error("failed to send resource", zap.Error(err))
-		if errors.Is(err, io.EOF) {
-			err = s.Connect()
-			if err != nil {
+// ingest sends the batch with the transport selected for the job and returns the IDs of the rejected resources
+func (s *ResourceSender) ingest(batch spooledBatch) ([]string, error) {
+	if s.useOpenSearch {
+		return s.ingestToPipeline(batch)
+	}
+	return nil, s.ingestToSink(batch)
+}
+
+func (s *ResourceSender) ingestToSink(batch spooledBatch) error {
+	grpcCtx := metadata.NewOutgoingContext(s.stopCtx, metadata.New(map[string]string{
+		"resource-job-id": fmt.Sprintf("%d", batch.JobID),
+	}))
+
+	docs := make([]*anypb.Any, 0, len(batch.Docs))
+	for _, doc := range batch.Docs {
+		docs = append(docs, &anypb.Any{Value: doc})
+	}
+
+	req := &golang.IngestRequest{Docs: docs}
+	if s.compression == "" {
+		_, err := s.client.Ingest(grpcCtx, req)
+		return err
+	}
+
+	_, err := s.client.Ingest(grpcCtx, req, grpc.UseCompressor(s.compression))
+	if status.Code(err) == codes.Unimplemented {
+		s.logger.Warn("sink does not support compressed requests, sending uncompressed",
+			zap.String("compression", s.compression), zap.Error(err))
+		s.compression = ""
+		_, err = s.client.Ingest(grpcCtx, req)
+	}
+	return err
+}
+
+// ingestWithRetry retries the batch with exponential backoff, reconnecting when the connection is gone
+func (s *ResourceSender) ingestWithRetry(batch spooledBatch) ([]string, error) {
+	var err error
+	for attempt := 0; attempt <= IngestMaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(s.retryBackoff * (1 << (attempt - 1))):
+			case <-s.stopCtx.Done():
+				return nil, s.stopCtx.Err()
+			}
+		}
+
+		var rejectedIDs []string
+		rejectedIDs, err = s.ingest(batch)
+		if err == nil {
+			return rejectedIDs, nil
+		}
+		s.logger.Warn("failed to send resources", zap.Error(err), zap.Int("attempt", attempt))
+		if !isRetryableIngestError(err) {
+			break
+		}
+
+		if errors.Is(err, io.EOF) || status.Code(err) == codes.Unavailable {
+			if err := s.Connect(); err != nil {
 				s.logger.Error("failed to reconnect", zap.Error(err))
 			}
 		}
-		return
 	}
+	return nil, err
 }
 
-func (s *ResourceSender) flushBuffer(force bool) {
-	if len(s.sendBuffer) == 0 {
-		return
+// replaySpool delivers the spooled batches, called once the backend accepted a batch again
+func (s *ResourceSender) replaySpool() {
+	lost, err := s.spool.Replay(func(batch spooledBatch) error {
+		rejectedIDs, err := s.ingest(batch)
+		if err != nil && !isRetryableIngestError(err) {
+			s.logger.Error("sink rejected spooled resources", zap.Error(err), zap.Int("count", len(batch.ResourceIDs)))
+			s.spooledResources -= len(batch.ResourceIDs)
+			s.rejectedResources += len(batch.ResourceIDs)
+			documentsFailed.WithLabelValues(DocumentFailureRejected).Add(float64(len(batch.ResourceIDs)))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.deliver(batch, rejectedIDs)
+		s.spooledResources -= len(batch.ResourceIDs)
+		return nil
+	})
+	if lost > 0 {
+		s.logger.Error("spooled resources could not be read, they are lost", zap.Int("count", lost))
+		s.spooledResources -= lost
+		s.lostResources += lost
+		documentsFailed.WithLabelValues(DocumentFailureLost).Add(float64(lost))
 	}
-
-	if !force && len(s.sendBuffer) < MinBufferSize {
-		return
+	if err != nil {
+		s.logger.Warn("failed to replay spooled resources", zap.Error(err))
 	}
+}
 
-	resourcesToSend := make([]es.Doc, 0, 2*len(s.sendBuffer))
+// Delete removes the stale resources and their lookup documents through the ingestion pipeline, over gRPC the
+// platform prunes the resources missing from the DescribedResourceIds of the job result instead
+func (s *ResourceSender) Delete(ctx context.Context, integrationID, resourceType string, resourceIDs []string) error {
+	if !s.useOpenSearch {
+		return ErrDeleteNotSupported
+	}
 
-	for _, resource := range s.sendBuffer {
-		kafkaResource := resource
-		keys, idx := kafkaResource.KeysAndIndex()
-		kafkaResource.EsID = es.HashOf(keys...)
-		kafkaResource.EsIndex = idx
+	docs := make([]bulkDocHeader, 0, 2*len(resourceIDs))
+	for _, resourceID := range resourceIDs {
+		resource := es.Resource{
+			ResourceID:    resourceID,
+			IntegrationID: integrationID,
+			ResourceType:  strings.ToLower(resourceType),
+		}
+		keys, idx := resource.KeysAndIndex()
+		docs = append(docs, bulkDocHeader{EsID: es.HashOf(keys...), EsIndex: idx, ResourceID: resourceID})
 
 		lookupResource := es.LookupResource{
-			PlatformID:      resource.PlatformID,
-			ResourceID:      resource.ResourceID,
-			ResourceName:    resource.ResourceName,
+			ResourceID:      resourceID,
+			IntegrationID:   integrationID,
 			IntegrationType: global.IntegrationName,
-			ResourceType:    strings.ToLower(resource.ResourceType),
+			ResourceType:    strings.ToLower(resourceType),
 			Metadata: es.LookupResourceMetadata{
 				Parameters: es.ConvertMapToString(s.params),
 			},
-			IntegrationID: resource.IntegrationID,
-			DescribedBy:   resource.DescribedBy,
-			DescribedAt:   resource.DescribedAt,
-			Tags:          resource.CanonicalTags,
 		}
 		lookupKeys, lookupIdx := lookupResource.KeysAndIndex()
-		lookupResource.EsID = es.HashOf(lookupKeys...)
-		lookupResource.EsIndex = lookupIdx
+		docs = append(docs, bulkDocHeader{EsID: es.HashOf(lookupKeys...), EsIndex: lookupIdx, ResourceID: resourceID})
+	}
+
+	var err error
+	for attempt := 0; attempt <= IngestMaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(s.retryBackoff * (1 << (attempt - 1))):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err = s.deleteFromPipeline(ctx, docs); err == nil || !isRetryableIngestError(err) {
+			return err
+		}
+		s.logger.Warn("failed to delete resources", zap.Error(err), zap.Int("attempt", attempt))
+	}
+	return err
+}
+
+// bufferResource builds and serializes the resource and its lookup documents, so the batches can be bounded by size
+func (s *ResourceSender) bufferResource(resource *es.Resource) (bufferedResource, error) {
+	kafkaResource := *resource
+	keys, idx := kafkaResource.KeysAndIndex()
+	kafkaResource.EsID = es.HashOf(keys...)
+	kafkaResource.EsIndex = idx
+
+	lookupResource := es.LookupResource{
+		PlatformID:      resource.PlatformID,
+		ResourceID:      resource.ResourceID,
+		ResourceName:    resource.ResourceName,
+		IntegrationType: global.IntegrationName,
+		ResourceType:    strings.ToLower(resource.ResourceType),
+		Metadata: es.LookupResourceMetadata{
+			Parameters: es.ConvertMapToString(s.params),
+		},
+		IntegrationID: resource.IntegrationID,
+		DescribedBy:   resource.DescribedBy,
+		DescribedAt:   resource.DescribedAt,
+		Tags:          resource.CanonicalTags,
+	}
+	lookupKeys, lookupIdx := lookupResource.KeysAndIndex()
+	lookupResource.EsID = es.HashOf(lookupKeys...)
+	lookupResource.EsIndex = lookupIdx
+
+	buffered := bufferedResource{resourceID: resource.ResourceID}
+	for _, doc := range []es.Doc{kafkaResource, lookupResource} {
+		docBytes, err := json.Marshal(doc)
+		if err != nil {
+			return bufferedResource{}, fmt.Errorf("failed to marshal resource: %w", err)
+		}
+		buffered.docs = append(buffered.docs, docBytes)
+		buffered.size += len(docBytes)
+	}
+	if buffered.size > MaxBatchBytes {
+		return bufferedResource{}, fmt.Errorf("resource is %d bytes, more than the %d bytes allowed in a batch", buffered.size, MaxBatchBytes)
+	}
+	return buffered, nil
+}
 
-		resourcesToSend = append(resourcesToSend, kafkaResource)
-		resourcesToSend = append(resourcesToSend, lookupResource)
+func (s *ResourceSender) flushBuffer(force bool) {
+	if len(s.sendBuffer) == 0 {
+		return
 	}
 
-	s.sendToBackend(resourcesToSend)
+	if !force && len(s.sendBuffer) < MinBufferSize {
+		return
+	}
+
+	batch := spooledBatch{
+		JobID:       s.jobID,
+		ResourceIDs: make([]string, 0, len(s.sendBuffer)),
+		Docs:        make([]json.RawMessage, 0, 2*len(s.sendBuffer)),
+	}
+	for _, buffered := range s.sendBuffer {
+		batch.ResourceIDs = append(batch.ResourceIDs, buffered.resourceID)
+		batch.Docs = append(batch.Docs, buffered.docs...)
+	}
+
+	s.sendToBackend(batch)
 	s.sendBuffer = nil
+	s.sendBufferBytes = 0
 }
 
-func (s *ResourceSender) Finish() {
-	s.resourceChannel <- nil
-	_ = <-s.doneChannel
-	s.conn.Close()
+func (s *ResourceSender) setFailure(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.failure == nil {
+		s.failure = err
+	}
+}
+
+func (s *ResourceSender) getFailure() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.failure
+}
+
+// Finish flushes the buffer and gives the spool a last chance, an error is returned if some resources were not delivered
+// or if ctx is done before the buffer is flushed. The handler is always stopped and joined before the connection is closed
+func (s *ResourceSender) Finish(ctx context.Context) error {
+	defer func() {
+		s.stop()
+		if err := s.conn.Close(); err != nil {
+			s.logger.Error("failed to close connection", zap.Error(err))
+		}
+	}()
+
+	select {
+	case s.resourceChannel <- senderRequest{}:
+	case <-s.doneChannel:
+		return ErrResourceSenderClosed
+	case <-ctx.Done():
+		s.abort()
+		return ctx.Err()
+	}
+	select {
+	case <-s.doneChannel:
+	case <-ctx.Done():
+		s.abort()
+		return ctx.Err()
+	}
+
+	if s.spooledResources > 0 {
+		s.replaySpool()
+	}
+	if err := s.spool.Close(); err != nil {
+		s.logger.Warn("failed to close the ingest spool", zap.Error(err))
+	}
+
+	undelivered := s.spooledResources + s.lostResources + s.rejectedResources
+	if undelivered == 0 {
+		return nil
+	}
+	// describing again is only worth it when some resources failed for a transient reason
+	errCode := IngestRejectedErrCode
+	if s.spooledResources > 0 || s.lostResources > 0 {
+		errCode = IngestFailedErrCode
+	}
+	return Error{
+		ErrCode: errCode,
+		error: fmt.Errorf("%d of %d resources were not delivered (%d spooled for replay, %d lost, %d rejected)",
+			undelivered, len(s.GetResourceIDs())+undelivered, s.spooledResources, s.lostResources, s.rejectedResources),
+	}
+}
+
+// Flush delivers the buffered resources, an error is returned when a resource sent so far is not delivered (it
+// is spooled or lost). The flush is queued behind the resources so it covers every one sent before
+func (s *ResourceSender) Flush(ctx context.Context) error {
+	flushed := make(chan error, 1)
+	select {
+	case s.resourceChannel <- senderRequest{flushed: flushed}:
+	case <-s.doneChannel:
+		return ErrResourceSenderClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-flushed:
+		return err
+	case <-s.doneChannel:
+		return ErrResourceSenderClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// undelivered reports the resources that were sent but not delivered yet, the rejected ones will never be and do
+// not count. Only called by the handler
+func (s *ResourceSender) undelivered() error {
+	if s.spooledResources > 0 || s.lostResources > 0 {
+		return Error{
+			ErrCode: IngestFailedErrCode,
+			error:   fmt.Errorf("%d resources not delivered (%d spooled for replay, %d lost)", s.spooledResources+s.lostResources, s.spooledResources, s.lostResources),
+		}
+	}
+	return nil
+}
+
+// abort stops the handler and waits for it, its ingest calls are cancelled so it returns promptly
+func (s *ResourceSender) abort() {
+	s.stop()
+	<-s.doneChannel
 }
 
 func (s *ResourceSender) GetResourceIDs() []string {
-	return s.resourceIDs
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return slices.Clone(s.resourceIDs)
 }
 
-func (s *ResourceSender) Send(resource *es.Resource) {
-	s.resourceChannel <- resource
+// Send queues the resource, it blocks while the queue is full and fails when ctx is done or the sender is dead
+func (s *ResourceSender) Send(ctx context.Context, resource *es.Resource) error {
+	if err := s.getFailure(); err != nil {
+		return err
+	}
+
+	select {
+	case s.resourceChannel <- senderRequest{resource: resource}:
+		return nil
+	case <-s.doneChannel:
+		return ErrResourceSenderClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,81 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/opengovern/og-util/pkg/es"
+)
+
+func TestResourceSenderFinishJoinsHandlerWhenCtxIsDone(t *testing.T) {
+	// the pipeline hangs until the test ends, the handler is stuck flushing
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	s := newTestResourceSender(t, server.URL, 1)
+
+	sendFullBatch(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Finish(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("finish returned %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-s.doneChannel:
+	default:
+		t.Fatal("finish returned while the handler is still running")
+	}
+	if len(s.GetResourceIDs()) != 0 {
+		t.Fatalf("%d resources reported as delivered", len(s.GetResourceIDs()))
+	}
+}
+
+func TestResourceSenderFlushConfirmsDelivery(t *testing.T) {
+	pipeline, server := newIngestionPipeline(t)
+	s := newTestResourceSender(t, server.URL, 1)
+	defer s.Finish(context.Background())
+
+	// fewer resources than a batch holds, only the flush sends them
+	for i := 0; i < 3; i++ {
+		if err := s.Send(context.Background(), &es.Resource{ResourceID: fmt.Sprint(i), IntegrationID: "integration", ResourceType: "semgrep/finding"}); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := len(s.GetResourceIDs()); got != 3 {
+		t.Fatalf("%d resources delivered after the flush, want 3", got)
+	}
+
+	pipeline.failing.Store(true)
+	if err := s.Send(context.Background(), &es.Resource{ResourceID: "3", IntegrationID: "integration", ResourceType: "semgrep/finding"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	var ingestErr Error
+	if err := s.Flush(context.Background()); !errors.As(err, &ingestErr) || ingestErr.ErrCode != IngestFailedErrCode {
+		t.Fatalf("flush of a spooled resource returned %v, want an %s error", err, IngestFailedErrCode)
+	}
+
+	// replayed with the next batch the backend accepts
+	pipeline.failing.Store(false)
+	if err := s.Send(context.Background(), &es.Resource{ResourceID: "4", IntegrationID: "integration", ResourceType: "semgrep/finding"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("flush after the backend recovered: %v", err)
+	}
+	if got := len(s.GetResourceIDs()); got != 5 {
+		t.Fatalf("%d resources delivered, want 5", got)
+	}
+}
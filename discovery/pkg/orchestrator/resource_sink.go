@@ -0,0 +1,209 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/opengovern/og-util/pkg/es"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ResourceSink receives the documents produced by doDescribe, an error from Send stops the describe
+type ResourceSink interface {
+	Send(ctx context.Context, resource *es.Resource) error
+	// Flush returns once the resources sent so far are delivered, an error when some of them are not
+	Flush(ctx context.Context) error
+	// Finish flushes anything buffered and releases the sink, no resources can be sent afterwards
+	Finish(ctx context.Context) error
+	// GetResourceIDs the resources delivered so far, a copy the caller may modify
+	GetResourceIDs() []string
+}
+
+// Tombstone marks a resource that no longer exists, sinks that can not delete write it instead
+type Tombstone struct {
+	ResourceID    string `json:"resource_id"`
+	IntegrationID string `json:"integration_id"`
+	ResourceType  string `json:"resource_type"`
+	Deleted       bool   `json:"deleted"`
+}
+
+func newTombstones(integrationID, resourceType string, resourceIDs []string) []Tombstone {
+	tombstones := make([]Tombstone, 0, len(resourceIDs))
+	for _, resourceID := range resourceIDs {
+		tombstones = append(tombstones, Tombstone{
+			ResourceID:    resourceID,
+			IntegrationID: integrationID,
+			ResourceType:  strings.ToLower(resourceType),
+			Deleted:       true,
+		})
+	}
+	return tombstones
+}
+
+// WriterSink writes every resource as a line of NDJSON to the underlying writer
+type WriterSink struct {
+	lock        sync.Mutex
+	writer      *bufio.Writer
+	closer      io.Closer
+	resourceIDs []string
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{
+		writer: bufio.NewWriter(w),
+	}
+}
+
+// NewFileSink creates (or truncates) the given file and writes the resources to it as NDJSON
+func NewFileSink(path string) (*WriterSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	s := NewWriterSink(file)
+	s.closer = file
+	return s, nil
+}
+
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+func (s *WriterSink) Send(ctx context.Context, resource *es.Resource) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	resJSON, err := json.Marshal(resource)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resource JSON: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err = s.writer.Write(append(resJSON, '\n')); err != nil {
+		return fmt.Errorf("failed to write resource: %w", err)
+	}
+	s.resourceIDs = append(s.resourceIDs, resource.ResourceID)
+	return nil
+}
+
+// Delete writes a Tombstone line per stale resource
+func (s *WriterSink) Delete(ctx context.Context, integrationID, resourceType string, resourceIDs []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, tombstone := range newTombstones(integrationID, resourceType, resourceIDs) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tombstoneJSON, err := json.Marshal(tombstone)
+		if err != nil {
+			return fmt.Errorf("failed to marshal tombstone JSON: %w", err)
+		}
+		if _, err = s.writer.Write(append(tombstoneJSON, '\n')); err != nil {
+			return fmt.Errorf("failed to write tombstone: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *WriterSink) Flush(_ context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush resources: %w", err)
+	}
+	return nil
+}
+
+func (s *WriterSink) Finish(_ context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush resources: %w", err)
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+func (s *WriterSink) GetResourceIDs() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return slices.Clone(s.resourceIDs)
+}
+
+// MemorySink keeps the resources in memory, useful for tests and for callers post-processing the result
+type MemorySink struct {
+	lock       sync.Mutex
+	resources  []*es.Resource
+	tombstones []Tombstone
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Send(ctx context.Context, resource *es.Resource) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.resources = append(s.resources, resource)
+	return nil
+}
+
+func (s *MemorySink) Delete(_ context.Context, integrationID, resourceType string, resourceIDs []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tombstones = append(s.tombstones, newTombstones(integrationID, resourceType, resourceIDs)...)
+	return nil
+}
+
+func (s *MemorySink) Flush(_ context.Context) error {
+	return nil
+}
+
+func (s *MemorySink) Finish(_ context.Context) error {
+	return nil
+}
+
+func (s *MemorySink) GetResourceIDs() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	resourceIDs := make([]string, 0, len(s.resources))
+	for _, resource := range s.resources {
+		resourceIDs = append(resourceIDs, resource.ResourceID)
+	}
+	return resourceIDs
+}
+
+func (s *MemorySink) Resources() []*es.Resource {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.resources
+}
+
+func (s *MemorySink) Tombstones() []Tombstone {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.tombstones
+}
@@ -0,0 +1,28 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/opengovern/og-util/pkg/es"
+)
+
+func TestWriterSinkResourceIDsAreACopy(t *testing.T) {
+	s := NewWriterSink(&bytes.Buffer{})
+	for _, resourceID := range []string{"a", "b", "c"} {
+		if err := s.Send(context.Background(), &es.Resource{ResourceID: resourceID}); err != nil {
+			t.Fatalf("send %s: %v", resourceID, err)
+		}
+	}
+
+	// the worker appends the unchanged resources to the result
+	resourceIDs := s.GetResourceIDs()[:2]
+	resourceIDs[0] = "changed"
+	_ = append(resourceIDs, "unchanged")
+
+	if got := fmt.Sprint(s.GetResourceIDs()); got != "[a b c]" {
+		t.Fatalf("sink resource ids %s, want [a b c]", got)
+	}
+}
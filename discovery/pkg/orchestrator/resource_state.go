@@ -0,0 +1,37 @@
+package orchestrator
+
+import (
+	"context"
+)
+
+var (
+	resourceStateStoreKey string = "resource_state_store"
+)
+
+// ResourceState what the last successful describe of an integration/resource type found
+type ResourceState struct {
+	ResourceIDs []string `json:"resource_ids"`
+	// Hashes content hash of every delivered resource, by resource ID
+	Hashes map[string]string `json:"hashes,omitempty"`
+}
+
+// ResourceStateStore keeps a ResourceState per integration and resource type where every worker finds it, Load
+// returns nil when the integration/resource type was never described successfully
+type ResourceStateStore interface {
+	Load(ctx context.Context, integrationID, resourceType string) (*ResourceState, error)
+	Save(ctx context.Context, integrationID, resourceType string, state ResourceState) error
+}
+
+// WithResourceStateStore enables the stale resource deletion and the change detection, without a store every
+// describe sends all the resources and deletes nothing
+func WithResourceStateStore(ctx context.Context, store ResourceStateStore) context.Context {
+	return context.WithValue(ctx, resourceStateStoreKey, store)
+}
+
+func GetResourceStateStoreFromContext(ctx context.Context) ResourceStateStore {
+	store, ok := ctx.Value(resourceStateStoreKey).(ResourceStateStore)
+	if !ok {
+		return nil
+	}
+	return store
+}
@@ -0,0 +1,122 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+
+	"github.com/opengovern/og-describer-semgrep/discovery/provider"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	requeueKey string = "requeue"
+)
+
+// RequeueError is returned by DescribeHandler when the job failed with a retryable error and was not reported,
+// the caller is expected to have the job delivered again
+type RequeueError struct {
+	error
+}
+
+func (e RequeueError) Unwrap() error {
+	return e.error
+}
+
+// JobFailedError is returned by DescribeHandler when the job failed and was reported as FAILED
+type JobFailedError struct {
+	error
+}
+
+func (e JobFailedError) Unwrap() error {
+	return e.error
+}
+
+// WithRequeue tells DescribeHandler the job queue can deliver the job again, retryable failures are then
+// returned as RequeueError instead of being reported as FAILED
+func WithRequeue(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requeueKey, true)
+}
+
+func requeueAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(requeueKey).(bool)
+	return allowed
+}
+
+// IsRetryable tells whether running the job again later may succeed: timeouts, network failures, a throttled or
+// failing Semgrep API and an unavailable platform are, anything else (bad credentials, invalid input, resources
+// the sink rejected) is reported as is
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+
+	var kerr Error
+	if errors.As(err, &kerr) && kerr.ErrCode == IngestFailedErrCode {
+		return true
+	}
+	var pipelineErr IngestionPipelineError
+	if errors.As(err, &pipelineErr) {
+		return pipelineErr.Retryable()
+	}
+
+	var apiErr provider.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+
+	if isRetryableNetworkError(err) {
+		return true
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableNetworkError whether err is a timeout or a broken connection, a bad certificate or URL and a host that
+// does not exist fail the same way every time
+func isRetryableNetworkError(err error) bool {
+	var (
+		unknownAuthorityErr x509.UnknownAuthorityError
+		certificateErr      x509.CertificateInvalidError
+		hostnameErr         x509.HostnameError
+		recordHeaderErr     tls.RecordHeaderError
+		dnsErr              *net.DNSError
+		urlErr              *url.Error
+	)
+	switch {
+	case errors.As(err, &unknownAuthorityErr), errors.As(err, &certificateErr), errors.As(err, &hostnameErr),
+		errors.As(err, &recordHeaderErr):
+		return false
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return false
+	case errors.As(err, &urlErr) && urlErr.Op == "parse":
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,60 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// timeoutError a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableNetworkErrors(t *testing.T) {
+	get := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://semgrep.dev/api/v1/deployments", Err: err}
+	}
+	dial := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: err}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "timeout", err: get(timeoutError{}), want: true},
+		{name: "connection refused", err: get(dial(os.NewSyscallError("connect", syscall.ECONNREFUSED))), want: true},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: true},
+		{name: "eof", err: get(io.EOF), want: true},
+		{name: "unexpected eof", err: get(io.ErrUnexpectedEOF), want: true},
+		{name: "context deadline", err: get(context.DeadlineExceeded), want: true},
+		{name: "temporary dns failure", err: get(dial(&net.DNSError{Err: "server misbehaving", Name: "semgrep.dev", IsTemporary: true})), want: true},
+		{name: "unknown host", err: get(dial(&net.DNSError{Err: "no such host", Name: "semgrep.dev", IsNotFound: true})), want: false},
+		{name: "unknown authority", err: get(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), want: false},
+		{name: "invalid certificate", err: get(x509.CertificateInvalidError{Reason: x509.Expired}), want: false},
+		{name: "hostname mismatch", err: get(x509.HostnameError{Host: "semgrep.dev"}), want: false},
+		{name: "not tls", err: get(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), want: false},
+		{name: "invalid url", err: &url.Error{Op: "parse", URL: "://semgrep", Err: errors.New("missing protocol scheme")}, want: false},
+		{name: "unsupported scheme", err: get(errors.New("unsupported protocol scheme")), want: false},
+		{name: "other", err: errors.New("boom"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Fatalf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	describe2 "github.com/opengovern/og-util/pkg/describe"
+	"go.uber.org/zap"
+	"sort"
+)
+
+// ErrDeleteNotSupported is returned by a ResourceDeleter whose backend cannot remove documents, the platform then
+// prunes the resources of the integration missing from the DescribedResourceIds of the job result
+var ErrDeleteNotSupported = errors.New("deleting resources is not supported")
+
+// ResourceDeleter is implemented by the sinks able to remove resources that no longer exist in Semgrep
+type ResourceDeleter interface {
+	Delete(ctx context.Context, integrationID, resourceType string, resourceIDs []string) error
+}
+
+// loadResourceState returns the state of the previous describe of the job integration/resource type, nil if there is none
+func loadResourceState(ctx context.Context, logger *zap.Logger, job describe2.DescribeJob) *ResourceState {
+	store := GetResourceStateStoreFromContext(ctx)
+	if store == nil {
+		return nil
+	}
+
+	state, err := store.Load(ctx, job.IntegrationID, job.ResourceType)
+	if err != nil {
+		logger.Error("failed to load previous resource state", zap.Error(err))
+		return nil
+	}
+	return state
+}
+
+func saveResourceState(ctx context.Context, logger *zap.Logger, job describe2.DescribeJob, state ResourceState) {
+	store := GetResourceStateStoreFromContext(ctx)
+	if store == nil {
+		return
+	}
+
+	if err := store.Save(ctx, job.IntegrationID, job.ResourceType, state); err != nil {
+		logger.Error("failed to save resource state", zap.Error(err))
+	}
+}
+
+// deleteStaleResources compares the resources described by a complete describe with the previous ones, the ones that
+// disappeared are deleted through the sink. A sink that can not delete leaves them to the platform, they are not in
+// the described resource IDs of the result. It returns false when the stale resources must be looked at again next time
+func deleteStaleResources(ctx context.Context, logger *zap.Logger, job describe2.DescribeJob, previous *ResourceState, describedIDs []string, sink ResourceSink) bool {
+	staleIDs := staleResourceIDs(previous, describedIDs)
+	if len(staleIDs) == 0 {
+		return true
+	}
+	if len(describedIDs) == 0 {
+		// an empty answer is more likely an API hiccup than everything being gone, keep the previous set
+		logger.Warn("nothing described, stale resources are not deleted", zap.String("resourceType", job.ResourceType),
+			zap.Int("previousCount", len(previous.ResourceIDs)))
+		return false
+	}
+
+	logger.Info("deleting stale resources", zap.String("resourceType", job.ResourceType), zap.Int("count", len(staleIDs)))
+	var err error
+	deleter, ok := sink.(ResourceDeleter)
+	if !ok {
+		err = ErrDeleteNotSupported
+	} else {
+		err = deleter.Delete(ctx, job.IntegrationID, job.ResourceType, staleIDs)
+	}
+	if errors.Is(err, ErrDeleteNotSupported) {
+		logger.Info("stale resources are left to the platform, the sink can not delete them",
+			zap.String("resourceType", job.ResourceType), zap.Int("count", len(staleIDs)))
+		return true
+	}
+	if err != nil {
+		logger.Error("failed to delete stale resources", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// nextResourceState the state to remember after a delivered describe, stale resources that were
+// not deleted are kept so they are found again next time
+func nextResourceState(previous *ResourceState, describedIDs []string, hashes map[string]string, staleHandled bool) ResourceState {
+	state := ResourceState{
+		ResourceIDs: describedIDs,
+		Hashes:      hashes,
+	}
+	if !staleHandled {
+		state.ResourceIDs = append(state.ResourceIDs, staleResourceIDs(previous, describedIDs)...)
+	}
+	return state
+}
+
+// mergedResourceState the state to remember after a describe resumed from a checkpoint, it only described part
+// of the resources so the previous ones are kept alongside
+func mergedResourceState(previous *ResourceState, describedIDs []string, hashes map[string]string) ResourceState {
+	state := ResourceState{
+		ResourceIDs: append(describedIDs, staleResourceIDs(previous, describedIDs)...),
+		Hashes:      make(map[string]string, len(hashes)),
+	}
+	if previous != nil {
+		for id, hash := range previous.Hashes {
+			state.Hashes[id] = hash
+		}
+	}
+	for id, hash := range hashes {
+		state.Hashes[id] = hash
+	}
+	return state
+}
+
+func staleResourceIDs(previous *ResourceState, describedIDs []string) []string {
+	if previous == nil {
+		return nil
+	}
+
+	described := make(map[string]struct{}, len(describedIDs))
+	for _, id := range describedIDs {
+		described[id] = struct{}{}
+	}
+
+	var staleIDs []string
+	for _, id := range previous.ResourceIDs {
+		if _, ok := described[id]; !ok {
+			staleIDs = append(staleIDs, id)
+		}
+	}
+	sort.Strings(staleIDs)
+	return staleIDs
+}
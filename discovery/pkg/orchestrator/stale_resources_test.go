@@ -0,0 +1,129 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	describe2 "github.com/opengovern/og-util/pkg/describe"
+	"go.uber.org/zap"
+)
+
+// failingDeleter a sink whose deletes fail with err
+type failingDeleter struct {
+	*MemorySink
+	err error
+}
+
+func (s failingDeleter) Delete(context.Context, string, string, []string) error {
+	return s.err
+}
+
+func TestDeleteStaleResources(t *testing.T) {
+	job := describe2.DescribeJob{IntegrationID: "integration", ResourceType: "Semgrep/Finding"}
+	previous := &ResourceState{ResourceIDs: []string{"a", "b", "c"}}
+	described := []string{"a", "b"}
+
+	tests := []struct {
+		name         string
+		sink         ResourceSink
+		described    []string
+		wantHandled  bool
+		wantStateIDs []string
+	}{
+		{
+			name:         "deleted",
+			sink:         NewMemorySink(),
+			described:    described,
+			wantHandled:  true,
+			wantStateIDs: []string{"a", "b"},
+		},
+		{
+			// the platform prunes what is missing from the described resource IDs
+			name:         "sink without delete",
+			sink:         struct{ ResourceSink }{NewMemorySink()},
+			described:    described,
+			wantHandled:  true,
+			wantStateIDs: []string{"a", "b"},
+		},
+		{
+			name:         "delete not supported",
+			sink:         failingDeleter{MemorySink: NewMemorySink(), err: ErrDeleteNotSupported},
+			described:    described,
+			wantHandled:  true,
+			wantStateIDs: []string{"a", "b"},
+		},
+		{
+			name:         "delete failed",
+			sink:         failingDeleter{MemorySink: NewMemorySink(), err: errors.New("unavailable")},
+			described:    described,
+			wantStateIDs: []string{"a", "b", "c"},
+		},
+		{
+			name:         "nothing described",
+			sink:         NewMemorySink(),
+			described:    nil,
+			wantStateIDs: []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := deleteStaleResources(context.Background(), zap.NewNop(), job, previous, tt.described, tt.sink)
+			if handled != tt.wantHandled {
+				t.Fatalf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+
+			state := nextResourceState(previous, tt.described, nil, handled)
+			if fmt.Sprint(state.ResourceIDs) != fmt.Sprint(tt.wantStateIDs) {
+				t.Fatalf("next state has %v, want %v", state.ResourceIDs, tt.wantStateIDs)
+			}
+		})
+	}
+}
+
+func TestDeleteStaleResourcesWritesTombstones(t *testing.T) {
+	job := describe2.DescribeJob{IntegrationID: "integration", ResourceType: "Semgrep/Finding"}
+	sink := NewMemorySink()
+
+	handled := deleteStaleResources(context.Background(), zap.NewNop(), job,
+		&ResourceState{ResourceIDs: []string{"a", "b", "c"}}, []string{"b"}, sink)
+	if !handled {
+		t.Fatal("stale resources not handled")
+	}
+
+	var deleted []string
+	for _, tombstone := range sink.Tombstones() {
+		if tombstone.IntegrationID != job.IntegrationID || tombstone.ResourceType != "semgrep/finding" || !tombstone.Deleted {
+			t.Fatalf("unexpected tombstone %+v", tombstone)
+		}
+		deleted = append(deleted, tombstone.ResourceID)
+	}
+	if fmt.Sprint(deleted) != "[a c]" {
+		t.Fatalf("deleted %v, want [a c]", deleted)
+	}
+}
+
+func TestMergedResourceStateKeepsPreviousResources(t *testing.T) {
+	previous := &ResourceState{
+		ResourceIDs: []string{"a", "b"},
+		Hashes:      map[string]string{"a": "1", "b": "2"},
+	}
+	state := mergedResourceState(previous, []string{"b", "c"}, map[string]string{"b": "3", "c": "4"})
+
+	if fmt.Sprint(state.ResourceIDs) != "[b c a]" {
+		t.Fatalf("merged state has %v, want [b c a]", state.ResourceIDs)
+	}
+	if fmt.Sprint(state.Hashes) != "map[a:1 b:3 c:4]" {
+		t.Fatalf("merged state hashes %v", state.Hashes)
+	}
+}
+
+func TestIndexedHashesSkipsUndeliveredResources(t *testing.T) {
+	pipeline := &ResourcePipeline{hashes: map[string]string{"a": "1", "b": "2", "c": "3"}}
+
+	hashes := pipeline.IndexedHashes([]string{"a", "c", "d"})
+	if fmt.Sprint(hashes) != "map[a:1 c:3]" {
+		t.Fatalf("indexed hashes %v, want map[a:1 c:3]", hashes)
+	}
+}
@@ -5,14 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/go-errors/errors"
-	model "github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
 	"github.com/opengovern/og-describer-semgrep/discovery/provider"
-	"github.com/opengovern/og-describer-semgrep/global"
 	describe2 "github.com/opengovern/og-util/pkg/describe"
 	"github.com/opengovern/og-util/pkg/es"
 	"github.com/opengovern/og-util/pkg/vault"
 	"go.uber.org/zap"
-	strconv "strconv"
+	"path"
 	"strings"
 )
 
@@ -22,6 +20,28 @@ type Error struct {
 	error
 }
 
+const PanicErrCode = "Panic"
+
+// panicError turns a recovered panic into an Error whose code points at the function that panicked,
+// so the same bug shows up under the same code however the message varies
+func panicError(r any) error {
+	wrapped := errors.Wrap(r, 2)
+
+	errCode := PanicErrCode
+	for _, frame := range wrapped.StackFrames() {
+		if frame.Package == "runtime" || strings.HasPrefix(frame.Package, "runtime/") {
+			continue
+		}
+		errCode = fmt.Sprintf("%s:%s.%s", PanicErrCode, path.Base(frame.Package), frame.Name)
+		break
+	}
+
+	return Error{
+		ErrCode: errCode,
+		error:   fmt.Errorf("paniced with error: %v", r),
+	}
+}
+
 func trimEmptyMaps(input map[string]any) {
 	for key, value := range input {
 		switch value.(type) {
@@ -57,7 +77,7 @@ func Do(ctx context.Context,
 	useOpenSearch bool) (resourceIDs []string, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("paniced with error: %v", r)
+			err = panicError(r)
 			logger.Error("paniced with error", zap.Error(err), zap.String("stackTrace", errors.Wrap(r, 2).ErrorStack()))
 		}
 	}()
@@ -71,106 +91,54 @@ func Do(ctx context.Context,
 	}
 	// logger.Info("decrypted config", zap.Any("config", config))
 
-	return doDescribe(ctx, logger, job, params, config, grpcEndpoint, ingestionPipelineEndpoint, describeDeliverToken, useOpenSearch)
+	logger.Info("Making New Resource Sender")
+	rs, err := NewResourceSender(grpcEndpoint, ingestionPipelineEndpoint, describeDeliverToken, job.JobID, params, useOpenSearch,
+		GetIngestConfigFromContext(ctx), GetGrpcTLSConfigFromContext(ctx), logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to resource sender: %w", err)
+	}
+
+	return doDescribe(ctx, logger, job, config, rs)
 }
 
 func doDescribe(
 	ctx context.Context,
 	logger *zap.Logger,
 	job describe2.DescribeJob,
-	params map[string]string,
 	config map[string]any,
-	grpcEndpoint, ingestionPipelineEndpoint string,
-	describeToken string,
-	useOpenSearch bool) ([]string, error) {
-	logger.Info("Making New Resource Sender")
-	rs, err := NewResourceSender(grpcEndpoint, ingestionPipelineEndpoint, describeToken, job.JobID, params, useOpenSearch, logger)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to resource sender: %w", err)
-	}
-
-	logger.Info("Connect to steampipe plugin")
-	plg := global.Plugin()
+	sink ResourceSink) ([]string, error) {
 	logger.Info("Account Config From Map")
 	creds, err := provider.AccountCredentialsFromMap(config)
 	if err != nil {
 		return nil, fmt.Errorf(" account credentials: %w", err)
 	}
 
-	f := func(resource model.Resource) error {
-		if resource.Description == nil {
-			return nil
-		}
-		descriptionJSON, err := json.Marshal(resource.Description)
-		if err != nil {
-			return fmt.Errorf("failed to marshal description: %w", err)
-		}
-		descriptionJSON, err = trimJsonFromEmptyObjects(descriptionJSON)
-		if err != nil {
-			return fmt.Errorf("failed to trim json: %w", err)
-		}
-
-		metadata, err := provider.GetResourceMetadata(job, resource)
-		if err != nil {
-			return fmt.Errorf("failed to get resource metadata")
-		}
-		err = provider.AdjustResource(job, &resource)
-		if err != nil {
-			return fmt.Errorf("failed to get resource metadata")
-		}
-
-		desc := resource.Description
-		err = json.Unmarshal(descriptionJSON, &desc)
-		if err != nil {
-			return fmt.Errorf("unmarshal description: %v", err.Error())
-		}
-
-		tags := make(map[string]string)
-
-		if plg != nil {
-			tags, _, err = global.ExtractTagsAndNames(logger, plg, job.ResourceType, resource)
-			if err != nil {
-				logger.Error("failed to build tags for service", zap.Error(err), zap.String("resourceType", job.ResourceType), zap.Any("resource", resource))
-			}
-		}
-
-		var description any
-		err = json.Unmarshal([]byte(descriptionJSON), &description)
-		if err != nil {
-			logger.Error("failed to parse resource description json", zap.Error(err))
-			return fmt.Errorf("failed to parse resource description json")
-		}
-
-		newTags := make([]es.Tag, 0, len(tags))
-		for k, v := range tags {
-			newTags = append(newTags, es.Tag{
-				// tags should be case-insensitive
-				Key:   strings.ToLower(k),
-				Value: strings.ToLower(v),
-			})
-		}
-
-		rs.Send(&es.Resource{
-			PlatformID:      fmt.Sprintf("%s:::%s:::%s", job.IntegrationID, job.ResourceType, resource.UniqueID()),
-			ResourceID:      resource.UniqueID(),
-			ResourceName:    resource.Name,
-			Description:     description,
-			IntegrationType: global.IntegrationName,
-			ResourceType:    strings.ToLower(job.ResourceType),
-			IntegrationID:   job.IntegrationID,
-			Metadata:        metadata,
-			CanonicalTags:   newTags,
-			DescribedAt:     job.DescribedAt,
-			DescribedBy:     strconv.FormatUint(uint64(job.JobID), 10),
-		})
-		return nil
-	}
-	clientStream := (*model.StreamSender)(&f)
+	pipeline, err := NewResourcePipeline(logger, job)
+	if err != nil {
+		return nil, err
+	}
+	previousState := loadResourceState(ctx, logger, job)
+	if previousState != nil {
+		pipeline.SetPreviousHashes(previousState.Hashes)
+	}
 
 	additionalParameters, err := provider.GetAdditionalParameters(job)
 	if err != nil {
 		return nil, err
 	}
+
+	// a retried job resumes the paginated describers where the failed attempt stopped
+	var checkpoints *provider.Checkpoints
+	if store := provider.GetCheckpointStoreFromContext(ctx); store != nil {
+		checkpoints = provider.NewCheckpoints(store, es.HashOf(job.IntegrationID, job.ResourceType), job.JobID, job.RetryCounter > 0)
+		// a page is only checkpointed once the sink delivered its resources
+		checkpoints.SetFlush(sink.Flush)
+		ctx = provider.WithCheckpoints(ctx, checkpoints)
+	}
+
+	coverage := provider.NewCoverage()
+	ctx = provider.WithCoverage(ctx, coverage)
+
 	err = GetResources(
 		ctx,
 		logger,
@@ -178,13 +146,53 @@ func doDescribe(
 		job.TriggerType,
 		creds,
 		additionalParameters,
-		clientStream,
+		pipeline.StreamSender(ctx, sink),
 	)
 	if err != nil {
+		// release the sink, what it already delivered is lost for this job anyway
+		_ = sink.Finish(ctx)
 		return nil, err
 	}
+	if invalidResources := pipeline.InvalidResources(); invalidResources > 0 {
+		logger.Warn("skipped resources with invalid descriptions", zap.String("resourceType", job.ResourceType), zap.Int("count", invalidResources))
+	}
 
-	rs.Finish()
+	describedIDs := pipeline.DescribedResourceIDs()
+	resumed := checkpoints.Resumed()
+	staleHandled := false
+	if resumed {
+		// the pages covered by the checkpoint were not described again, their resources are not stale
+		logger.Info("describe resumed from a checkpoint, stale resources are not deleted", zap.String("resourceType", job.ResourceType))
+	} else if incomplete := coverage.Incomplete(); len(incomplete) > 0 {
+		// the resources of what was not listed completely would look stale
+		logger.Warn("some deployments or projects were not listed completely, stale resources are not deleted",
+			zap.String("resourceType", job.ResourceType), zap.Strings("scopes", incomplete))
+	} else {
+		// the describe went through every deployment without error, whatever was not found again is gone
+		staleHandled = deleteStaleResources(ctx, logger, job, previousState, describedIDs, sink)
+	}
+	unchangedIDs := pipeline.UnchangedResourceIDs()
+	if len(unchangedIDs) > 0 {
+		logger.Info("skipped unchanged resources", zap.String("resourceType", job.ResourceType), zap.Int("count", len(unchangedIDs)))
+	}
+
+	if err = sink.Finish(ctx); err != nil {
+		logger.Error("failed to finish resource sink", zap.Error(err))
+		// the job is failed but the delivered resources are still reported
+		return append(sink.GetResourceIDs(), unchangedIDs...), err
+	}
+	if err = checkpoints.Clear(ctx); err != nil {
+		logger.Warn("failed to clear checkpoint", zap.Error(err))
+	}
 
-	return rs.GetResourceIDs(), nil
+	// only remembered once delivered, otherwise the undelivered resources would be skipped as unchanged next time
+	resourceIDs := append(sink.GetResourceIDs(), unchangedIDs...)
+	hashes := pipeline.IndexedHashes(resourceIDs)
+	if resumed {
+		saveResourceState(ctx, logger, job, mergedResourceState(previousState, describedIDs, hashes))
+		// the resources found before the checkpoint are still there as far as we know
+		return append(resourceIDs, staleResourceIDs(previousState, describedIDs)...), nil
+	}
+	saveResourceState(ctx, logger, job, nextResourceState(previousState, describedIDs, hashes, staleHandled))
+	return resourceIDs, nil
 }
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/opengovern/og-describer-semgrep/discovery/pkg/orchestrator"
+	"github.com/opengovern/og-util/pkg/es"
+)
+
+const ResourceStateBucket = "og_describer_semgrep_resource_states"
+
+// ObjectResourceStateStore keeps the resource state of every integration/resource type in an object store bucket,
+// a state holds an ID and a hash per resource and easily outgrows the size limit of a KV value
+type ObjectResourceStateStore struct {
+	objects jetstream.ObjectStore
+}
+
+func NewObjectResourceStateStore(ctx context.Context, js jetstream.JetStream) (*ObjectResourceStateStore, error) {
+	objects, err := js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{
+		Bucket:      ResourceStateBucket,
+		Description: "resources found by the last successful describe of every integration and resource type",
+		Storage:     jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource state bucket: %w", err)
+	}
+	return &ObjectResourceStateStore{objects: objects}, nil
+}
+
+func (s *ObjectResourceStateStore) Load(ctx context.Context, integrationID, resourceType string) (*orchestrator.ResourceState, error) {
+	data, err := s.objects.GetBytes(ctx, resourceStateName(integrationID, resourceType))
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load resource state: %w", err)
+	}
+
+	var state orchestrator.ResourceState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse resource state: %w", err)
+	}
+	return &state, nil
+}
+
+func (s *ObjectResourceStateStore) Save(ctx context.Context, integrationID, resourceType string, state orchestrator.ResourceState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resource state: %w", err)
+	}
+	if _, err = s.objects.PutBytes(ctx, resourceStateName(integrationID, resourceType), data); err != nil {
+		return fmt.Errorf("failed to save resource state: %w", err)
+	}
+	return nil
+}
+
+func resourceStateName(integrationID, resourceType string) string {
+	return es.HashOf(integrationID, resourceType)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/opengovern/og-describer-semgrep/global"
+	"github.com/opengovern/og-describer-semgrep/global/maps"
+)
+
+var (
+	output = flag.String("output", "", "Path to the output directory for the description schemas")
+)
+
+func main() {
+	flag.Parse()
+
+	if output == nil || len(*output) == 0 {
+		v := "global/maps/schemas"
+		output = &v
+	}
+
+	err := os.MkdirAll(*output, os.ModePerm)
+	if err != nil {
+		panic(err)
+	}
+
+	for resourceType, table := range maps.ResourceTypesToTables {
+		schema, err := global.DescriptionSchema(resourceType)
+		if err != nil {
+			panic(err)
+		}
+		schema.Title = resourceType
+
+		schemaJson, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+
+		err = os.WriteFile(filepath.Join(*output, table+".schema.json"), append(schemaJson, '\n'), 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	apiLimitsKey string = "apiLimits"
+)
+
+// APILimits how hard the describers may use the Semgrep API of an integration
+type APILimits struct {
+	RequestsPerMinute int           `yaml:"requestsPerMinute"`
+	Concurrency       int           `yaml:"concurrency"`
+	MaxRetries        int           `yaml:"maxRetries"`
+	RetryBackoff      time.Duration `yaml:"retryBackoff"`
+}
+
+var DefaultAPILimits = APILimits{
+	RequestsPerMinute: 200,
+	Concurrency:       10,
+	MaxRetries:        5,
+	RetryBackoff:      5 * time.Minute,
+}
+
+func WithAPILimits(ctx context.Context, limits APILimits) context.Context {
+	return context.WithValue(ctx, apiLimitsKey, limits)
+}
+
+// GetAPILimitsFromContext returns DefaultAPILimits when the context does not carry limits
+func GetAPILimitsFromContext(ctx context.Context) APILimits {
+	limits, ok := ctx.Value(apiLimitsKey).(APILimits)
+	if !ok {
+		return DefaultAPILimits
+	}
+	return limits
+}
+
+// NewHandler a SemGrepAPIHandler for token within the limits
+func (l APILimits) NewHandler(token string) *SemGrepAPIHandler {
+	return NewSemGrepAPIHandler(token, rate.Every(time.Minute/time.Duration(l.RequestsPerMinute)), 1, l.Concurrency, l.MaxRetries, l.RetryBackoff)
+}
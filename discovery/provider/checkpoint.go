@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	checkpointStoreKey string = "checkpoint_store"
+	checkpointsKey     string = "checkpoints"
+)
+
+// Checkpoint how far a paginated describe got, Page is the next page to fetch from Deployment
+type Checkpoint struct {
+	JobID      uint      `json:"job_id"`
+	Deployment string    `json:"deployment"`
+	Page       int       `json:"page"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// CheckpointStore keeps a checkpoint per key, Load returns nil when there is none
+type CheckpointStore interface {
+	Load(ctx context.Context, key string) (*Checkpoint, error)
+	Save(ctx context.Context, key string, checkpoint Checkpoint) error
+	Delete(ctx context.Context, key string) error
+}
+
+func WithCheckpointStore(ctx context.Context, store CheckpointStore) context.Context {
+	return context.WithValue(ctx, checkpointStoreKey, store)
+}
+
+func GetCheckpointStoreFromContext(ctx context.Context) CheckpointStore {
+	store, ok := ctx.Value(checkpointStoreKey).(CheckpointStore)
+	if !ok {
+		return nil
+	}
+	return store
+}
+
+// Checkpoints the checkpoint of one job, the describers save their progress with it and resume from it when the
+// job is tried again. All methods are safe on a nil Checkpoints so describers run without one (e.g. from the CLI)
+type Checkpoints struct {
+	store CheckpointStore
+	key   string
+	jobID uint
+	// retry the platform retries a failed job under a new job ID, its checkpoint is resumed too
+	retry bool
+
+	// flush confirms the resources described so far are delivered, a checkpoint is only saved after it
+	flush func(ctx context.Context) error
+
+	resumed atomic.Bool
+	dirty   atomic.Bool
+}
+
+func NewCheckpoints(store CheckpointStore, key string, jobID uint, retry bool) *Checkpoints {
+	return &Checkpoints{store: store, key: key, jobID: jobID, retry: retry}
+}
+
+func WithCheckpoints(ctx context.Context, checkpoints *Checkpoints) context.Context {
+	return context.WithValue(ctx, checkpointsKey, checkpoints)
+}
+
+func GetCheckpointsFromContext(ctx context.Context) *Checkpoints {
+	checkpoints, ok := ctx.Value(checkpointsKey).(*Checkpoints)
+	if !ok {
+		return nil
+	}
+	return checkpoints
+}
+
+// Load returns the checkpoint left by a previous attempt of the job, nil when the describe starts over. A
+// checkpoint of another job is only resumed by a retry, a new describe must go through everything again
+func (c *Checkpoints) Load(ctx context.Context) *Checkpoint {
+	if c == nil {
+		return nil
+	}
+	checkpoint, err := c.store.Load(ctx, c.key)
+	if err != nil {
+		GetLoggerFromContext(ctx).Warn("failed to load checkpoint, starting over", zap.Error(err))
+		return nil
+	}
+	if checkpoint == nil {
+		return nil
+	}
+	c.dirty.Store(true)
+	if checkpoint.JobID != c.jobID && !c.retry {
+		return nil
+	}
+	return checkpoint
+}
+
+// SetFlush makes Save wait for flush, the progress is not recorded when it fails so the resources it did not
+// deliver are described again by the next attempt
+func (c *Checkpoints) SetFlush(flush func(ctx context.Context) error) {
+	if c == nil {
+		return
+	}
+	c.flush = flush
+}
+
+// SetResumed the describer skipped what the checkpoint covered, the resources described are then only a part
+// of what exists
+func (c *Checkpoints) SetResumed() {
+	if c == nil {
+		return
+	}
+	c.resumed.Store(true)
+}
+
+func (c *Checkpoints) Resumed() bool {
+	if c == nil {
+		return false
+	}
+	return c.resumed.Load()
+}
+
+// Save records the progress once the resources described so far are delivered, a failure only costs the work
+// done since the previous checkpoint
+func (c *Checkpoints) Save(ctx context.Context, deployment string, page int) {
+	if c == nil {
+		return
+	}
+	if c.flush != nil {
+		if err := c.flush(ctx); err != nil {
+			GetLoggerFromContext(ctx).Warn("resources not delivered, checkpoint not saved", zap.Error(err))
+			return
+		}
+	}
+	err := c.store.Save(ctx, c.key, Checkpoint{
+		JobID:      c.jobID,
+		Deployment: deployment,
+		Page:       page,
+		UpdatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		GetLoggerFromContext(ctx).Warn("failed to save checkpoint", zap.Error(err))
+		return
+	}
+	c.dirty.Store(true)
+}
+
+// Clear removes the checkpoint once the describe succeeded
+func (c *Checkpoints) Clear(ctx context.Context) error {
+	if c == nil || !c.dirty.Load() {
+		return nil
+	}
+	if err := c.store.Delete(ctx, c.key); err != nil {
+		return err
+	}
+	c.dirty.Store(false)
+	return nil
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// memoryCheckpointStore keeps the checkpoints in memory and records the calls made to it
+type memoryCheckpointStore struct {
+	lock        sync.Mutex
+	checkpoints map[string]Checkpoint
+	events      *[]string
+}
+
+func newMemoryCheckpointStore(events *[]string) *memoryCheckpointStore {
+	return &memoryCheckpointStore{checkpoints: make(map[string]Checkpoint), events: events}
+}
+
+func (s *memoryCheckpointStore) Load(_ context.Context, key string) (*Checkpoint, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	checkpoint, ok := s.checkpoints[key]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (s *memoryCheckpointStore) Save(_ context.Context, key string, checkpoint Checkpoint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.checkpoints[key] = checkpoint
+	*s.events = append(*s.events, "save")
+	return nil
+}
+
+func (s *memoryCheckpointStore) Delete(_ context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.checkpoints, key)
+	return nil
+}
+
+func TestCheckpointsSaveAfterFlush(t *testing.T) {
+	var events []string
+	store := newMemoryCheckpointStore(&events)
+	checkpoints := NewCheckpoints(store, "key", 1, false)
+	checkpoints.SetFlush(func(context.Context) error {
+		events = append(events, "flush")
+		return nil
+	})
+
+	checkpoints.Save(context.Background(), "acme", 1)
+	if len(events) != 2 || events[0] != "flush" || events[1] != "save" {
+		t.Fatalf("events %v, want [flush save]", events)
+	}
+	if checkpoint := checkpoints.Load(context.Background()); checkpoint == nil || checkpoint.Page != 1 {
+		t.Fatalf("loaded %+v, want page 1", checkpoint)
+	}
+}
+
+func TestCheckpointsNotSavedWhenFlushFails(t *testing.T) {
+	var events []string
+	store := newMemoryCheckpointStore(&events)
+	checkpoints := NewCheckpoints(store, "key", 1, false)
+
+	checkpoints.Save(context.Background(), "acme", 1)
+	checkpoints.SetFlush(func(context.Context) error {
+		return errors.New("resources spooled")
+	})
+	checkpoints.Save(context.Background(), "acme", 2)
+
+	// the next attempt resumes from the last page whose resources were delivered
+	if checkpoint := checkpoints.Load(context.Background()); checkpoint == nil || checkpoint.Page != 1 {
+		t.Fatalf("loaded %+v, want page 1", checkpoint)
+	}
+}
+
+func TestCheckpointsResume(t *testing.T) {
+	var events []string
+	store := newMemoryCheckpointStore(&events)
+	NewCheckpoints(store, "key", 1, false).Save(context.Background(), "acme", 3)
+
+	if checkpoint := NewCheckpoints(store, "key", 1, false).Load(context.Background()); checkpoint == nil || checkpoint.Page != 3 {
+		t.Fatalf("redelivered job loaded %+v, want page 3", checkpoint)
+	}
+	if checkpoint := NewCheckpoints(store, "key", 2, true).Load(context.Background()); checkpoint == nil || checkpoint.Page != 3 {
+		t.Fatalf("retried job loaded %+v, want page 3", checkpoint)
+	}
+	if checkpoint := NewCheckpoints(store, "key", 2, false).Load(context.Background()); checkpoint != nil {
+		t.Fatalf("new job loaded %+v, want no checkpoint", checkpoint)
+	}
+}
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+var (
+	coverageKey string = "coverage"
+)
+
+// Coverage records the deployments and projects a describe started listing and the ones it listed completely, the
+// stale resources are only deleted after a describe that listed everything it started. All methods are safe on a
+// nil Coverage so describers run without one (e.g. from the CLI)
+type Coverage struct {
+	lock    sync.Mutex
+	pending map[string]struct{}
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{pending: make(map[string]struct{})}
+}
+
+func WithCoverage(ctx context.Context, coverage *Coverage) context.Context {
+	return context.WithValue(ctx, coverageKey, coverage)
+}
+
+func GetCoverageFromContext(ctx context.Context) *Coverage {
+	coverage, ok := ctx.Value(coverageKey).(*Coverage)
+	if !ok {
+		return nil
+	}
+	return coverage
+}
+
+// DeploymentScope the scope of the resources of a deployment
+func DeploymentScope(deploymentSlug string) string {
+	return deploymentSlug
+}
+
+// ProjectScope the scope of the resources of a project of a deployment
+func ProjectScope(deploymentSlug, projectName string) string {
+	return deploymentSlug + "/" + projectName
+}
+
+// Start the listing of the scope started
+func (c *Coverage) Start(scope string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pending[scope] = struct{}{}
+}
+
+// Done the scope was listed completely
+func (c *Coverage) Done(scope string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pending, scope)
+}
+
+// Incomplete the scopes whose listing started but did not complete
+func (c *Coverage) Incomplete() []string {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	scopes := make([]string, 0, len(c.pending))
+	for scope := range c.pending {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
@@ -4,8 +4,26 @@ import (
 	"encoding/json"
 	model "github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
 	"github.com/opengovern/og-util/pkg/describe"
+	"reflect"
+	"strings"
 )
 
+const (
+	DerivedTagsLabel = "derived_tags"
+
+	DerivedTagSeverity   = "severity"
+	DerivedTagProduct    = "product"
+	DerivedTagRepository = "repository"
+
+	// ProjectTagsKey the resource type tag whose fields hold the Semgrep project tags
+	ProjectTagsKey = "project_tags"
+
+	// FindingProductType the findings endpoint lists the Semgrep Code findings unless asked for another issue type
+	FindingProductType = "sast"
+)
+
+var DefaultDerivedTags = []string{DerivedTagSeverity, DerivedTagProduct, DerivedTagRepository}
+
 // AccountCredentialsFromMap TODO: converts a map to a configs.IntegrationCredentials.
 func AccountCredentialsFromMap(m map[string]any) (model.IntegrationCredentials, error) {
 	mj, err := json.Marshal(m)
@@ -22,18 +40,69 @@ func AccountCredentialsFromMap(m map[string]any) (model.IntegrationCredentials,
 	return c, nil
 }
 
-// GetResourceMetadata TODO: Get metadata as a map to add to the resources
+// GetResourceMetadata Get metadata as a map to add to the resources
 func GetResourceMetadata(job describe.DescribeJob, resource model.Resource) (map[string]string, error) {
 	metadata := make(map[string]string)
 
+	m, ok := resource.IntegrationMetadata.(Metadata)
+	if !ok {
+		return metadata, nil
+	}
+	mj, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(mj, &metadata)
+	if err != nil {
+		return nil, err
+	}
+
 	return metadata, nil
 }
 
-// AdjustResource TODO: Do any needed adjustment on resource object before storing
+// AdjustResource Fill the resource metadata fields the describer left empty from its description before storing
 func AdjustResource(job describe.DescribeJob, resource *model.Resource) error {
+	m, _ := resource.IntegrationMetadata.(Metadata)
+
+	switch description := resource.Description.(type) {
+	case DeploymentDescription:
+		setIfZero(&m.DeploymentID, description.ID)
+		setIfEmpty(&m.DeploymentSlug, description.Slug)
+	case ProjectDescription:
+		setIfZero(&m.DeploymentID, description.DeploymentID)
+		setIfEmpty(&m.ProjectName, description.Name)
+		setIfEmpty(&m.RepositoryURL, description.URL)
+	case PolicyDescription:
+		setIfZero(&m.DeploymentID, description.DeploymentID)
+		setIfEmpty(&m.ProductType, description.ProductType)
+	case ScanDescription:
+		setIfZero(&m.DeploymentID, description.DeploymentID)
+	case FindingDescription:
+		setIfZero(&m.DeploymentID, description.DeploymentID)
+		setIfEmpty(&m.ProjectName, description.Repository.Name)
+		setIfEmpty(&m.RepositoryURL, description.Repository.URL)
+		setIfEmpty(&m.ProductType, FindingProductType)
+	}
+	resource.IntegrationMetadata = m
+
+	if resource.Name == "" {
+		resource.Name = resource.ID
+	}
 	return nil
 }
 
+func setIfEmpty(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+func setIfZero(field *int, value int) {
+	if *field == 0 {
+		*field = value
+	}
+}
+
 // GetAdditionalParameters TODO: pass additional parameters needed in describer wrappers in /provider/describer_wrapper.go
 func GetAdditionalParameters(job describe.DescribeJob) (map[string]string, error) {
 	additionalParameters := make(map[string]string)
@@ -44,3 +113,83 @@ func GetAdditionalParameters(job describe.DescribeJob) (map[string]string, error
 
 	return additionalParameters, nil
 }
+
+// GetResourceTags Build canonical tags from the Tags of the resource type, every tag key lists the resource fields
+// its value is read from. The fields of the ProjectTagsKey hold Semgrep project tags which become tags of their own,
+// the other keys are derived tags enabled per integration
+func GetResourceTags(job describe.DescribeJob, resource model.Resource, tagFields map[string][]string) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	for _, field := range tagFields[ProjectTagsKey] {
+		projectTags, _ := resourceField(resource, field).([]string)
+		for _, tag := range projectTags {
+			key, value := parseProjectTag(tag)
+			if key == "" {
+				continue
+			}
+			tags[key] = value
+		}
+	}
+
+	for _, key := range derivedTagKeys(job) {
+		for _, field := range tagFields[key] {
+			if value, _ := resourceField(resource, field).(string); value != "" {
+				tags[key] = value
+				break
+			}
+		}
+	}
+
+	return tags, nil
+}
+
+// resourceField value of a dot separated field path of the resource, e.g. Description.Severity, nil when the
+// resource has no such field
+func resourceField(resource model.Resource, path string) any {
+	v := reflect.ValueOf(resource)
+	for _, name := range strings.Split(path, ".") {
+		for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil
+		}
+		v = v.FieldByName(name)
+		if !v.IsValid() {
+			return nil
+		}
+	}
+	if !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// parseProjectTag Semgrep project tags are free-form strings, "key:value" and "key=value" are split into a pair
+func parseProjectTag(tag string) (string, string) {
+	tag = strings.TrimSpace(tag)
+	if i := strings.IndexAny(tag, ":="); i > 0 {
+		return strings.TrimSpace(tag[:i]), strings.TrimSpace(tag[i+1:])
+	}
+	return tag, ""
+}
+
+// derivedTagKeys Derived tags can be narrowed down with a comma separated derived_tags integration label
+func derivedTagKeys(job describe.DescribeJob) []string {
+	label, ok := job.IntegrationLabels[DerivedTagsLabel]
+	if !ok {
+		return DefaultDerivedTags
+	}
+
+	var keys []string
+	for _, key := range strings.Split(label, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,40 @@
+package provider
+
+import (
+	"testing"
+
+	model "github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
+	"github.com/opengovern/og-util/pkg/describe"
+)
+
+func TestResourceMetadataDeploymentID(t *testing.T) {
+	tests := []struct {
+		name        string
+		description any
+		want        string
+	}{
+		{name: "deployment", description: DeploymentDescription{ID: 7}, want: "7"},
+		{name: "scan", description: ScanDescription{ID: "42", DeploymentID: 7}, want: "7"},
+		{name: "finding", description: FindingDescription{ID: 1, DeploymentID: 7, FirstSeenScanID: "42"}, want: "7"},
+		{name: "unknown deployment", description: PolicyDescription{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := model.Resource{ID: "1", Description: tt.description}
+			if err := AdjustResource(describe.DescribeJob{}, &resource); err != nil {
+				t.Fatalf("adjust resource: %v", err)
+			}
+			metadata, err := GetResourceMetadata(describe.DescribeJob{}, resource)
+			if err != nil {
+				t.Fatalf("resource metadata: %v", err)
+			}
+			got, ok := metadata["deployment_id"]
+			if tt.want == "" && ok {
+				t.Fatalf("deployment_id %q, want it left out", got)
+			}
+			if got != tt.want {
+				t.Fatalf("deployment_id %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
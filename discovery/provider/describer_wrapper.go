@@ -5,8 +5,6 @@ import (
 	"github.com/opengovern/og-describer-semgrep/discovery/pkg/models"
 	"github.com/opengovern/og-util/pkg/describe/enums"
 	"golang.org/x/net/context"
-	"golang.org/x/time/rate"
-	"time"
 )
 
 // DescribeListBySemGrep A wrapper to pass SemGrep authorization to describers functions
@@ -20,7 +18,7 @@ func DescribeListBySemGrep(describe func(context.Context, *SemGrepAPIHandler, *m
 			return nil, errors.New("token must be configured")
 		}
 
-		semGrepAPIHandler := NewSemGrepAPIHandler(cfg.Token, rate.Every(time.Minute/200), 1, 10, 5, 5*time.Minute)
+		semGrepAPIHandler := GetAPILimitsFromContext(ctx).NewHandler(cfg.Token)
 
 		// Get values from describers
 		var values []models.Resource
@@ -44,7 +42,7 @@ func DescribeSingleBySemGrep(describe func(context.Context, *SemGrepAPIHandler,
 			return nil, errors.New("token must be configured")
 		}
 
-		semGrepAPIHandler := NewSemGrepAPIHandler(cfg.Token, rate.Every(time.Minute/200), 1, 10, 5, 5*time.Minute)
+		semGrepAPIHandler := GetAPILimitsFromContext(ctx).NewHandler(cfg.Token)
 
 		// Get value from describers
 		value, err := describe(ctx, semGrepAPIHandler, resourceID)
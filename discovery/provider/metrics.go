@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	semgrepAPIRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "og_describer_semgrep_api_requests_total",
+		Help: "Semgrep API requests by response status code, error when no response was received",
+	}, []string{"status"})
+	semgrepAPIRequestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "og_describer_semgrep_api_request_duration_seconds",
+		Help:    "Latency of the Semgrep API requests, including reading the response",
+		Buckets: prometheus.DefBuckets,
+	})
+	semgrepAPIRateLimited = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "og_describer_semgrep_api_rate_limited_total",
+		Help: "Semgrep API requests answered with 429 Too Many Requests",
+	})
+)
+
+func observeAPIRequest(resp *http.Response, start time.Time) {
+	semgrepAPIRequestDuration.Observe(time.Since(start).Seconds())
+	if resp == nil {
+		semgrepAPIRequests.WithLabelValues("error").Inc()
+		return
+	}
+	semgrepAPIRequests.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		semgrepAPIRateLimited.Inc()
+	}
+}
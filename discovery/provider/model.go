@@ -2,7 +2,13 @@
 
 package provider
 
-type Metadata struct{}
+type Metadata struct {
+	DeploymentID   int    `json:"deployment_id,omitempty,string"`
+	DeploymentSlug string `json:"deployment_slug,omitempty"`
+	ProjectName    string `json:"project_name,omitempty"`
+	RepositoryURL  string `json:"repository_url,omitempty"`
+	ProductType    string `json:"product_type,omitempty"`
+}
 
 type DeploymentsResponse struct {
 	Deployments []DeploymentJSON `json:"deployments"`
@@ -24,9 +30,9 @@ type DeploymentJSON struct {
 }
 
 type DeploymentDescription struct {
-	Slug     string
-	ID       int
-	Name     string
+	Slug     string `jsonschema:"required"`
+	ID       int    `jsonschema:"required"`
+	Name     string `jsonschema:"required"`
 	Findings Finding
 }
 
@@ -46,8 +52,9 @@ type ProjectJSON struct {
 }
 
 type ProjectDescription struct {
-	ID            int
-	Name          string
+	ID            int `jsonschema:"required"`
+	DeploymentID  int
+	Name          string `jsonschema:"required"`
 	URL           string
 	Tags          []string
 	CreatedAt     string
@@ -69,11 +76,12 @@ type PolicyJSON struct {
 }
 
 type PolicyDescription struct {
-	ID          string
-	Name        string
-	Slug        string
-	ProductType string
-	IsDefault   bool
+	ID           string `jsonschema:"required"`
+	DeploymentID int
+	Name         string `jsonschema:"required"`
+	Slug         string
+	ProductType  string
+	IsDefault    bool
 }
 
 type ScansListResponse struct {
@@ -110,8 +118,10 @@ type ScanJSON struct {
 }
 
 type ScanDescription struct {
-	ID             string
-	DeploymentID   string
+	ID             string `jsonschema:"required"`
+	DeploymentID   int
+	ProjectID      int
+	ProjectTags    []string
 	RepositoryID   string
 	Branch         string
 	Commit         string
@@ -282,9 +292,12 @@ type FindingObject struct {
 }
 
 type FindingDescription struct {
-	ID              int
+	ID              int `jsonschema:"required"`
+	DeploymentID    int
+	ProjectID       int
+	ProjectTags     []string
 	Ref             string
-	FirstSeenScanID int
+	FirstSeenScanID string
 	SyntacticID     string
 	MatchBasedID    string
 	ExternalTicket  ExternalTicket
@@ -293,12 +306,12 @@ type FindingDescription struct {
 	TriageState     string
 	State           string
 	Status          string
-	Severity        string
+	Severity        string `jsonschema:"required"`
 	Confidence      string
 	Categories      []string
 	CreatedAt       string
 	RelevantSince   string
-	RuleName        string
+	RuleName        string `jsonschema:"required"`
 	RuleMessage     string
 	Location        Location
 	SourcingPolicy  SourcingPolicy
@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	progressKey string = "progress"
+)
+
+// Progress is shared by the describers, the API handler and the orchestrator to report how far a describe got,
+// all methods are safe on a nil Progress so describers run without one (e.g. from the CLI)
+type Progress struct {
+	resources atomic.Int64
+	apiCalls  atomic.Int64
+
+	lock       sync.Mutex
+	deployment string
+	project    string
+}
+
+type ProgressSnapshot struct {
+	Resources  int64
+	APICalls   int64
+	Deployment string
+	Project    string
+}
+
+func WithProgress(ctx context.Context, progress *Progress) context.Context {
+	return context.WithValue(ctx, progressKey, progress)
+}
+
+func GetProgressFromContext(ctx context.Context) *Progress {
+	progress, ok := ctx.Value(progressKey).(*Progress)
+	if !ok {
+		return nil
+	}
+	return progress
+}
+
+func (p *Progress) AddResource() {
+	if p == nil {
+		return
+	}
+	p.resources.Add(1)
+}
+
+func (p *Progress) AddAPICall() {
+	if p == nil {
+		return
+	}
+	p.apiCalls.Add(1)
+}
+
+// SetLocation the deployment and project being described, project is empty for deployment wide listings
+func (p *Progress) SetLocation(deployment, project string) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.deployment = deployment
+	p.project = project
+}
+
+func (p *Progress) Snapshot() ProgressSnapshot {
+	if p == nil {
+		return ProgressSnapshot{}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return ProgressSnapshot{
+		Resources:  p.resources.Load(),
+		APICalls:   p.apiCalls.Load(),
+		Deployment: p.deployment,
+		Project:    p.project,
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"golang.org/x/time/rate"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -32,66 +33,114 @@ func NewSemGrepAPIHandler(token string, rateLimit rate.Limit, burst int, maxConc
 	}
 }
 
-// DoRequest executes the Semgrep API request with rate limiting, retries, and concurrency control.
-func (h *SemGrepAPIHandler) DoRequest(ctx context.Context, req *http.Request, requestFunc func(req *http.Request) (*http.Response, error)) error {
+// APIError the Semgrep API answered with a non-2xx status
+type APIError struct {
+	StatusCode int
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("semgrep api responded with status %d", e.StatusCode)
+}
+
+// Retryable throttling and server side failures may succeed later, anything else will fail the same way again
+func (e APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// DoRequest executes the Semgrep API request with rate limiting, retries, and concurrency control. Every response
+// is recorded in the metrics, a non-2xx status is an APIError and decode only reads the body of a 2xx response
+func (h *SemGrepAPIHandler) DoRequest(ctx context.Context, req *http.Request, decode func(resp *http.Response) error) error {
 	h.Semaphore <- struct{}{}
 	defer func() { <-h.Semaphore }()
-	var resp *http.Response
+	req = req.WithContext(ctx)
+	// Set request headers
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", h.Token))
+
 	var err error
 	for attempt := 0; attempt <= h.MaxRetries; attempt++ {
 		// Wait based on rate limiter
 		if err = h.RateLimiter.Wait(ctx); err != nil {
 			return err
 		}
-		// Set request headers
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", h.Token))
-		// Execute the request function
-		resp, err = requestFunc(req)
+		if attempt > 0 && req.GetBody != nil {
+			// the previous attempt consumed the body
+			if req.Body, err = req.GetBody(); err != nil {
+				return err
+			}
+		}
+
+		var resp *http.Response
+		resp, err = h.do(ctx, req, decode)
 		if err == nil {
 			return nil
 		}
 		if resp == nil {
+			// Handle temporary network errors
+			if isTemporary(err) {
+				if err = sleep(ctx, h.RetryBackoff*(1<<attempt)); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		var apiErr APIError
+		if !errors.As(err, &apiErr) || !apiErr.Retryable() {
 			return err
 		}
 		// Set rate limiter new value
-		var resetDuration int
-		if resp != nil {
-			retryAfter := resp.Header.Get("Retry-After")
-			if retryAfter != "" {
-				resetDuration, _ = strconv.Atoi(retryAfter)
-			}
-			var remainRequests int
-			remainRequestsStr := resp.Header.Get("X-RateLimit-Remaining")
-			if remainRequestsStr != "" {
-				remainRequests, err = strconv.Atoi(remainRequestsStr)
-				if err == nil && resetDuration > 0 {
-					h.RateLimiter = rate.NewLimiter(rate.Every(time.Duration(resetDuration)/time.Duration(remainRequests)), 1)
-				}
-			}
+		var resetDuration time.Duration
+		if retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After")); retryAfter > 0 {
+			resetDuration = time.Duration(retryAfter) * time.Second
 		}
-		// Handle rate limit errors
-		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
-			if resetDuration > 0 {
-				time.Sleep(time.Duration(resetDuration))
-				continue
-			}
-			// Exponential backoff if headers are missing
-			backoff := h.RetryBackoff * (1 << attempt)
-			time.Sleep(backoff)
-			continue
+		if remainRequests, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); remainRequests > 0 && resetDuration > 0 {
+			h.RateLimiter.SetLimit(rate.Every(resetDuration / time.Duration(remainRequests)))
+		}
+		// Handle rate limit errors, exponential backoff if headers are missing
+		backoff := h.RetryBackoff * (1 << attempt)
+		if resp.StatusCode == http.StatusTooManyRequests && resetDuration > 0 {
+			backoff = resetDuration
 		}
-		// Handle temporary network errors
-		if isTemporary(err) {
-			backoff := h.RetryBackoff * (1 << attempt)
-			time.Sleep(backoff)
-			continue
+		if sleepErr := sleep(ctx, backoff); sleepErr != nil {
+			return sleepErr
 		}
-		break
 	}
 	return err
 }
 
+// do runs one attempt of the request, resp is the response received if any
+func (h *SemGrepAPIHandler) do(ctx context.Context, req *http.Request, decode func(resp *http.Response) error) (resp *http.Response, err error) {
+	GetProgressFromContext(ctx).AddAPICall()
+	start := time.Now()
+	defer func() { observeAPIRequest(resp, start) }()
+
+	resp, err = h.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request execution failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// an error body decodes into an empty page, it must not pass for an empty listing
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp, APIError{StatusCode: resp.StatusCode}
+	}
+	return resp, decode(resp)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // isTemporary checks if an error is temporary.
 func isTemporary(err error) bool {
 	if err == nil {
@@ -106,7 +155,6 @@ func isTemporary(err error) bool {
 
 func ListDeployments(ctx context.Context, handler *SemGrepAPIHandler) ([]DeploymentJSON, error) {
 	var deploymentListResponse DeploymentsResponse
-	var resp *http.Response
 	baseURL := "https://semgrep.dev/api/v1/deployments"
 
 	req, err := http.NewRequest("GET", baseURL, nil)
@@ -114,21 +162,14 @@ func ListDeployments(ctx context.Context, handler *SemGrepAPIHandler) ([]Deploym
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	requestFunc := func(req *http.Request) (*http.Response, error) {
-		var e error
-		resp, e = handler.Client.Do(req)
-		if e != nil {
-			return nil, fmt.Errorf("request execution failed: %w", e)
+	decode := func(resp *http.Response) error {
+		if e := json.NewDecoder(resp.Body).Decode(&deploymentListResponse); e != nil {
+			return fmt.Errorf("failed to decode response: %w", e)
 		}
-		defer resp.Body.Close()
-
-		if e = json.NewDecoder(resp.Body).Decode(&deploymentListResponse); e != nil {
-			return nil, fmt.Errorf("failed to decode response: %w", e)
-		}
-		return resp, nil
+		return nil
 	}
 
-	err = handler.DoRequest(ctx, req, requestFunc)
+	err = handler.DoRequest(ctx, req, decode)
 	if err != nil {
 		return nil, fmt.Errorf("error during request handling: %w", err)
 	}
@@ -139,7 +180,6 @@ func ListDeployments(ctx context.Context, handler *SemGrepAPIHandler) ([]Deploym
 func ListProjects(ctx context.Context, handler *SemGrepAPIHandler, deploymentSlug string) ([]ProjectJSON, error) {
 	var projects []ProjectJSON
 	var projectListResponse ProjectsListResponse
-	var resp *http.Response
 	baseURL := "https://semgrep.dev/api/v1/deployments/"
 	page := 0
 
@@ -154,22 +194,15 @@ func ListProjects(ctx context.Context, handler *SemGrepAPIHandler, deploymentSlu
 			return nil, fmt.Errorf("failed to create request: %w", err)
 		}
 
-		requestFunc := func(req *http.Request) (*http.Response, error) {
-			var e error
-			resp, e = handler.Client.Do(req)
-			if e != nil {
-				return nil, fmt.Errorf("request execution failed: %w", e)
-			}
-			defer resp.Body.Close()
-
-			if e = json.NewDecoder(resp.Body).Decode(&projectListResponse); e != nil {
-				return nil, fmt.Errorf("failed to decode response: %w", e)
+		decode := func(resp *http.Response) error {
+			if e := json.NewDecoder(resp.Body).Decode(&projectListResponse); e != nil {
+				return fmt.Errorf("failed to decode response: %w", e)
 			}
 			projects = append(projects, projectListResponse.Projects...)
-			return resp, nil
+			return nil
 		}
 
-		err = handler.DoRequest(ctx, req, requestFunc)
+		err = handler.DoRequest(ctx, req, decode)
 		if err != nil {
 			return nil, fmt.Errorf("error during request handling: %w", err)
 		}
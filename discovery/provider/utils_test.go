@@ -0,0 +1,101 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+)
+
+func newTestAPIHandler(t *testing.T, statuses ...int) (*SemGrepAPIHandler, *http.Request, *atomic.Int64) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"deployments":[{"id":1,"slug":"acme"}]}`))
+			return
+		}
+		// valid JSON, it would decode into an empty page
+		_, _ = w.Write([]byte(`{"error":"failed"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSemGrepAPIHandler("token", rate.Inf, 1, 1, 2, time.Millisecond), req, &requests
+}
+
+func decodeDeployments(deployments *DeploymentsResponse) func(resp *http.Response) error {
+	return func(resp *http.Response) error {
+		return json.NewDecoder(resp.Body).Decode(deployments)
+	}
+}
+
+func TestDoRequestFailsOnErrorStatus(t *testing.T) {
+	handler, req, requests := newTestAPIHandler(t, http.StatusForbidden)
+	forbidden := testutil.ToFloat64(semgrepAPIRequests.WithLabelValues(strconv.Itoa(http.StatusForbidden)))
+
+	err := handler.DoRequest(context.Background(), req, func(resp *http.Response) error {
+		t.Fatal("the body of an error status must not be decoded")
+		return nil
+	})
+
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("DoRequest returned %v, want an APIError with status %d", err, http.StatusForbidden)
+	}
+	if apiErr.Retryable() {
+		t.Fatal("a 403 must not be retryable")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("a 403 was sent %d times, want 1", got)
+	}
+	if got := testutil.ToFloat64(semgrepAPIRequests.WithLabelValues(strconv.Itoa(http.StatusForbidden))) - forbidden; got != 1 {
+		t.Fatalf("%v requests recorded with status 403, want 1", got)
+	}
+}
+
+func TestDoRequestRetriesThrottledRequests(t *testing.T) {
+	handler, req, requests := newTestAPIHandler(t, http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK)
+	rateLimited := testutil.ToFloat64(semgrepAPIRateLimited)
+
+	var deployments DeploymentsResponse
+	if err := handler.DoRequest(context.Background(), req, decodeDeployments(&deployments)); err != nil {
+		t.Fatalf("DoRequest: %v", err)
+	}
+	if len(deployments.Deployments) != 1 {
+		t.Fatalf("decoded %d deployments, want 1", len(deployments.Deployments))
+	}
+	if got := requests.Load(); got != 3 {
+		t.Fatalf("sent %d requests, want 3", got)
+	}
+	if got := testutil.ToFloat64(semgrepAPIRateLimited) - rateLimited; got != 1 {
+		t.Fatalf("%v requests recorded as rate limited, want 1", got)
+	}
+}
+
+func TestDoRequestGivesUpAfterMaxRetries(t *testing.T) {
+	handler, req, requests := newTestAPIHandler(t, http.StatusBadGateway)
+
+	var deployments DeploymentsResponse
+	err := handler.DoRequest(context.Background(), req, decodeDeployments(&deployments))
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || !apiErr.Retryable() {
+		t.Fatalf("DoRequest returned %v, want a retryable APIError", err)
+	}
+	if got := requests.Load(); got != int64(handler.MaxRetries+1) {
+		t.Fatalf("sent %d requests, want %d", got, handler.MaxRetries+1)
+	}
+}
@@ -23,41 +23,54 @@ var ResourceTypes = map[string]model.ResourceType{
 	"Semgrep/Project": {
 		IntegrationType: constants.IntegrationName,
 		ResourceName:    "Semgrep/Project",
-		Tags:            map[string][]string{},
-		Labels:          map[string]string{},
-		Annotations:     map[string]string{},
-		ListDescriber:   provider.DescribeListBySemGrep(describers.ListProjects),
-		GetDescriber:    nil,
+		Tags: map[string][]string{
+			"project_tags": {"Description.Tags"},
+			"repository":   {"IntegrationMetadata.ProjectName"},
+		},
+		Labels:        map[string]string{},
+		Annotations:   map[string]string{},
+		ListDescriber: provider.DescribeListBySemGrep(describers.ListProjects),
+		GetDescriber:  nil,
 	},
 
 	"Semgrep/Policy": {
 		IntegrationType: constants.IntegrationName,
 		ResourceName:    "Semgrep/Policy",
-		Tags:            map[string][]string{},
-		Labels:          map[string]string{},
-		Annotations:     map[string]string{},
-		ListDescriber:   provider.DescribeListBySemGrep(describers.ListPolicies),
-		GetDescriber:    nil,
+		Tags: map[string][]string{
+			"product": {"IntegrationMetadata.ProductType"},
+		},
+		Labels:        map[string]string{},
+		Annotations:   map[string]string{},
+		ListDescriber: provider.DescribeListBySemGrep(describers.ListPolicies),
+		GetDescriber:  nil,
 	},
 
 	"Semgrep/Scan": {
 		IntegrationType: constants.IntegrationName,
 		ResourceName:    "Semgrep/Scan",
-		Tags:            map[string][]string{},
-		Labels:          map[string]string{},
-		Annotations:     map[string]string{},
-		ListDescriber:   provider.DescribeListBySemGrep(describers.ListScans),
-		GetDescriber:    nil,
+		Tags: map[string][]string{
+			"project_tags": {"Description.ProjectTags"},
+			"repository":   {"IntegrationMetadata.ProjectName"},
+		},
+		Labels:        map[string]string{},
+		Annotations:   map[string]string{},
+		ListDescriber: provider.DescribeListBySemGrep(describers.ListScans),
+		GetDescriber:  nil,
 	},
 
 	"Semgrep/Finding": {
 		IntegrationType: constants.IntegrationName,
 		ResourceName:    "Semgrep/Finding",
-		Tags:            map[string][]string{},
-		Labels:          map[string]string{},
-		Annotations:     map[string]string{},
-		ListDescriber:   provider.DescribeListBySemGrep(describers.ListFindings),
-		GetDescriber:    nil,
+		Tags: map[string][]string{
+			"product":      {"IntegrationMetadata.ProductType"},
+			"project_tags": {"Description.ProjectTags"},
+			"repository":   {"IntegrationMetadata.ProjectName"},
+			"severity":     {"Description.Severity"},
+		},
+		Labels:        map[string]string{},
+		Annotations:   map[string]string{},
+		ListDescriber: provider.DescribeListBySemGrep(describers.ListFindings),
+		GetDescriber:  nil,
 	},
 }
 
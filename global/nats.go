@@ -6,4 +6,5 @@ const (
 	ConsumerGroup        = "describer-semgrep"
 	JobQueueTopicManuals = "og_describer_semgrep_manuals_job_queue"
 	ConsumerGroupManuals = "describer-semgrep-manuals"
+	DeadLetterTopic      = "og_describer_semgrep_dead_letter"
 )
@@ -0,0 +1,24 @@
+package global
+
+import (
+	"fmt"
+	"github.com/opengovern/og-describer-semgrep/discovery/pkg/jsonschema"
+	"github.com/opengovern/og-describer-semgrep/global/maps"
+	"reflect"
+	"strings"
+)
+
+// DescriptionSchema returns the JSON schema generated from the description model of the resource type
+func DescriptionSchema(resourceType string) (*jsonschema.Schema, error) {
+	for k, v := range maps.ResourceTypeToDescription {
+		if strings.ToLower(k) != strings.ToLower(resourceType) {
+			continue
+		}
+		field, ok := reflect.TypeOf(v).FieldByName("Description")
+		if !ok {
+			return nil, fmt.Errorf("no description field in model of resourceType: %s", resourceType)
+		}
+		return jsonschema.Generate(field.Type), nil
+	}
+	return nil, fmt.Errorf("cannot find description model for resourceType: %s", resourceType)
+}